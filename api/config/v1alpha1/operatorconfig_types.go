@@ -0,0 +1,66 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+const (
+	// The ACI parameters are discovered from the ConfigMap deployed by the ACI CNI
+	ProviderAciCni = "aci-cni"
+	// The ACI parameters are set in the configuration file/flags. Used with other CNIs or in lab environments
+	ProviderStatic = "static"
+)
+
+// AciConfig defines the ACI fabric parameters used to configure the APIC
+type AciConfig struct {
+	// APIC controllers of the cluster
+	ApicHosts []string `json:"apicHosts,omitempty"`
+	// APIC user. Used if the credentials do not define it
+	ApicUsername string `json:"apicUsername,omitempty"`
+	// Tenant where the APIC objects are created
+	PolicyTenant string `json:"policyTenant,omitempty"`
+	// Bridge Domain of the Pods
+	PodBridgeDomain string `json:"podBridgeDomain,omitempty"`
+	// VMM Domain of the Kubernetes cluster
+	VmmDomain string `json:"vmmDomain,omitempty"`
+	// Application Profile of the default EPG
+	DefaultApplicationProfile string `json:"defaultApplicationProfile,omitempty"`
+	// EPG of the Pods not included in any SegmentationPolicy. Its contracts are inherited by the SegmentationPolicy EPGs
+	DefaultEndpointGroup string `json:"defaultEndpointGroup,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OperatorConfig is the Schema for the configuration file of the operator (--config)
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec returns the configurations for controllers
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// Source of the ACI parameters: aci-cni (default) or static
+	Provider string `json:"provider,omitempty"`
+	// ACI parameters. Used by the static provider
+	Aci AciConfig `json:"aci,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceEndpointGroupSpec defines the desired state of NamespaceEndpointGroup
+type NamespaceEndpointGroupSpec struct {
+	// Namespace whose Pods are placed in the EPG
+	Namespace string `json:"namespace"`
+}
+
+// NamespaceEndpointGroupStatus defines the observed state of NamespaceEndpointGroup
+type NamespaceEndpointGroupStatus struct {
+	// DN of the EPG on the APIC
+	// +optional
+	Dn string `json:"dn,omitempty"`
+	// +optional
+	BridgeDomain string `json:"bridgeDomain,omitempty"`
+	// +optional
+	VmmDomain string `json:"vmmDomain,omitempty"`
+	// EPG (<application profile>/<EPG>) whose contracts are inherited
+	// +optional
+	Master string `json:"master,omitempty"`
+	// +optional
+	ConsumedContracts []string `json:"consumedContracts,omitempty"`
+	// +optional
+	ProvidedContracts []string `json:"providedContracts,omitempty"`
+	// Settings of the EPG on the APIC, requested by the annotations of the Namespace
+	// +optional
+	IntraEpgIsolation bool `json:"intraEpgIsolation,omitempty"`
+	// +optional
+	PreferredGroup bool `json:"preferredGroup,omitempty"`
+	// +optional
+	FloodOnEncap bool `json:"floodOnEncap,omitempty"`
+	// SegmentationPolicies (<namespace>/<name>) referencing the EPG
+	// +optional
+	Policies []string `json:"policies,omitempty"`
+	// Created if the EPG is configured on the APIC, Missing otherwise
+	// +optional
+	State string `json:"state,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".spec.namespace",description="Namespace"
+//+kubebuilder:printcolumn:name="DN",type="string",JSONPath=".status.dn",description="DN of the EPG"
+//+kubebuilder:printcolumn:name="Bridge Domain",type="string",JSONPath=".status.bridgeDomain",description="Bridge Domain"
+//+kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="APIC EPG state"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:resource:scope=Cluster,shortName=nsepg
+//+kubebuilder:subresource:status
+
+// NamespaceEndpointGroup is the Schema for the namespaceendpointgroups API. It reflects the EPG of a Namespace on the APIC and is
+// named after the Namespace. It is read-only: the EPG is configured by the SegmentationPolicies referencing it
+type NamespaceEndpointGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NamespaceEndpointGroupSpec   `json:"spec,omitempty"`
+	Status NamespaceEndpointGroupStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NamespaceEndpointGroupList contains a list of NamespaceEndpointGroup
+type NamespaceEndpointGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespaceEndpointGroup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NamespaceEndpointGroup{}, &NamespaceEndpointGroupList{})
+}
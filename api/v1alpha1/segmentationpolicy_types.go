@@ -30,8 +30,29 @@ type SegmentationPolicySpec struct {
 
 	Namespaces []string   `json:"namespaces"`
 	Rules      []RuleSpec `json:"rules"`
+	// Stop applying changes to the APIC, e.g. during maintenance windows. The policy is fully reconciled again once resumed
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// What happens to the APIC objects when the policy is deleted. Delete removes them, Retain keeps them without the annotations of
+	// the operator (e.g. to hand them over to another tool) and Orphan leaves them untouched
+	// +kubebuilder:validation:Enum=Delete;Retain;Orphan
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Take ownership of the EPGs, contract and filters with the names of the policy which already exist on the APIC and are not
+	// managed by the operator. Otherwise the policy is not applied while such objects exist
+	// +optional
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
 }
 
+type DeletionPolicy string
+
+const (
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
 type RuleSpec struct {
 	Eth  string `json:"eth,omitempty"`
 	IP   string `json:"ip,omitempty"`
@@ -43,6 +64,29 @@ type SegmentationPolicyStatus struct {
 	Namespaces string `json:"namespaces"`
 	Rules      string `json:"rules"`
 	State      string `json:"state"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Changes the operator would make on the APIC. Only set in dry-run mode
+	// +optional
+	Plan []PlannedChange `json:"plan,omitempty"`
+	// DNs of the APIC objects not managed by the operator which prevent the policy from being applied
+	// +optional
+	PreExisting []string `json:"preExisting,omitempty"`
+	// EPGs (Namespaces) attached to the contract of the policy on the APIC. Shared EPGs are only deleted once no policy references them
+	// +optional
+	EndpointGroups []string `json:"endpointGroups,omitempty"`
+}
+
+// Change of an APIC object computed in dry-run mode
+type PlannedChange struct {
+	// +kubebuilder:validation:Enum=create;update;delete
+	Action string `json:"action"`
+	Class  string `json:"class"`
+	Dn     string `json:"dn"`
+	// +optional
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -22,9 +22,136 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceEndpointGroup) DeepCopyInto(out *NamespaceEndpointGroup) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceEndpointGroup.
+func (in *NamespaceEndpointGroup) DeepCopy() *NamespaceEndpointGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceEndpointGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespaceEndpointGroup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceEndpointGroupList) DeepCopyInto(out *NamespaceEndpointGroupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NamespaceEndpointGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceEndpointGroupList.
+func (in *NamespaceEndpointGroupList) DeepCopy() *NamespaceEndpointGroupList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceEndpointGroupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespaceEndpointGroupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceEndpointGroupSpec) DeepCopyInto(out *NamespaceEndpointGroupSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceEndpointGroupSpec.
+func (in *NamespaceEndpointGroupSpec) DeepCopy() *NamespaceEndpointGroupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceEndpointGroupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceEndpointGroupStatus) DeepCopyInto(out *NamespaceEndpointGroupStatus) {
+	*out = *in
+	if in.ConsumedContracts != nil {
+		in, out := &in.ConsumedContracts, &out.ConsumedContracts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProvidedContracts != nil {
+		in, out := &in.ProvidedContracts, &out.ProvidedContracts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceEndpointGroupStatus.
+func (in *NamespaceEndpointGroupStatus) DeepCopy() *NamespaceEndpointGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceEndpointGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedChange) DeepCopyInto(out *PlannedChange) {
+	*out = *in
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedChange.
+func (in *PlannedChange) DeepCopy() *PlannedChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RuleSpec) DeepCopyInto(out *RuleSpec) {
 	*out = *in
@@ -46,7 +173,7 @@ func (in *SegmentationPolicy) DeepCopyInto(out *SegmentationPolicy) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SegmentationPolicy.
@@ -127,6 +254,30 @@ func (in *SegmentationPolicySpec) DeepCopy() *SegmentationPolicySpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SegmentationPolicyStatus) DeepCopyInto(out *SegmentationPolicyStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = make([]PlannedChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PreExisting != nil {
+		in, out := &in.PreExisting, &out.PreExisting
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EndpointGroups != nil {
+		in, out := &in.EndpointGroups, &out.EndpointGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SegmentationPolicyStatus.
@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/utils"
+)
+
+const (
+	// Condition of the SegmentationPolicies reporting the APIC objects which existed before the policy and are not managed by the operator
+	ConditionPreExistingObjects = "PreExistingObjects"
+
+	ReasonAdoptionRequired = "AdoptionRequired"
+	ReasonAdopted          = "Adopted"
+)
+
+// Find the EPGs, contract and filters of the SegmentationPolicy which already exist on the APIC but are not managed by the operator:
+// EPGs without the tag of any SegmentationPolicy, filters without the tag of this policy and a contract either not annotated by the
+// operator or none of whose filters is tagged by this policy
+func (r *SegmentationPolicyReconciler) preExistingObjects(ctx context.Context, cniConf AciCniConfig, segPol *v1alpha1.SegmentationPolicy) ([]string, error) {
+	preExisting := []string{}
+	tenantName := cniConf.PolicyTenant
+	appName := appProfileName(r.ClusterID, tenantName)
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces); err != nil {
+		return nil, err
+	}
+	nsClusterNames := []string{}
+	for _, ns := range namespaces.Items {
+		nsClusterNames = append(nsClusterNames, ns.Name)
+	}
+	policies := &v1alpha1.SegmentationPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		return nil, err
+	}
+	policyNames := []string{}
+	for _, pol := range policies.Items {
+		policyNames = append(policyNames, policyObjectName(r.ClusterID, pol.Name))
+	}
+	for _, ns := range utils.Intersect(nsClusterNames, segPol.Spec.Namespaces) {
+		exists, err := r.apic(ctx).EpgExists(ns, appName, tenantName)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		annotations, err := r.apic(ctx).GetAnnotationsEpg(ns, appName, tenantName)
+		if err != nil {
+			return nil, err
+		}
+		if len(utils.Intersect(annotations, policyNames)) == 0 {
+			preExisting = append(preExisting, fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, ns))
+		}
+	}
+
+	polName := policyObjectName(r.ClusterID, segPol.Name)
+	owned, err := r.apic(ctx).GetFilterWithAnnotation(tenantName, polName)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range segPol.Spec.Rules {
+		filterName := ruleFilterName(r.ClusterID, segPol.Name, rule)
+		exists, err := r.apic(ctx).FilterExists(filterName, tenantName)
+		if err != nil {
+			return nil, err
+		}
+		if exists && !utils.Contains(owned, filterName) {
+			preExisting = append(preExisting, fmt.Sprintf("uni/tn-%s/flt-%s", tenantName, filterName))
+		}
+	}
+
+	contractDn := fmt.Sprintf("uni/tn-%s/brc-%s", tenantName, polName)
+	contract, err := r.apic(ctx).GetObject(contractDn)
+	if err != nil {
+		return nil, err
+	}
+	if contract == nil {
+		return preExisting, nil
+	}
+	filters, err := r.apic(ctx).GetContractFilters(polName, tenantName)
+	if err != nil {
+		return nil, err
+	}
+	if contract["annotation"] != "orchestrator:kubernetes" || (len(filters) > 0 && len(utils.Intersect(filters, owned)) == 0) {
+		preExisting = append(preExisting, contractDn)
+	}
+	return preExisting, nil
+}
+
+// Check whether the SegmentationPolicy can take ownership of the APIC objects with its names. The policy is blocked if any of them
+// exists without being managed by the operator, unless it opts in to adopt them. It returns true if the reconcile must stop
+func (r *SegmentationPolicyReconciler) checkPreExistingObjects(ctx context.Context, cniConf AciCniConfig, segPol *v1alpha1.SegmentationPolicy) (bool, ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	preExisting, err := r.preExistingObjects(ctx, cniConf, segPol)
+	if err != nil {
+		// The policy is not reconciled until the APIC objects can be read, the request is retried with backoff
+		err = fmt.Errorf("error occurred while looking for pre-existing APIC objects: %w", err)
+		r.apicErrorEvent(segPol, err)
+		return true, ctrl.Result{}, err
+	}
+	segPol.Status.PreExisting = nil
+	if len(preExisting) == 0 {
+		if meta.IsStatusConditionTrue(segPol.Status.Conditions, ConditionPreExistingObjects) {
+			meta.RemoveStatusCondition(&segPol.Status.Conditions, ConditionPreExistingObjects)
+		}
+		return false, ctrl.Result{}, nil
+	}
+
+	if segPol.Spec.AdoptExisting {
+		logger.Info(fmt.Sprintf("Adopting the pre-existing APIC objects %s", strings.Join(preExisting, ", ")))
+		meta.SetStatusCondition(&segPol.Status.Conditions, metav1.Condition{
+			Type:               ConditionPreExistingObjects,
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonAdopted,
+			Message:            fmt.Sprintf("Adopted the APIC objects %s", strings.Join(preExisting, ", ")),
+			ObservedGeneration: segPol.Generation,
+		})
+		r.event(segPol, corev1.EventTypeNormal, ReasonAdopted, fmt.Sprintf("Adopted the APIC objects %s", strings.Join(preExisting, ", ")))
+		return false, ctrl.Result{}, nil
+	}
+
+	// Nothing is posted to the APIC. The policy is reconciled again once it opts in to adopt the objects
+	logger.Info(fmt.Sprintf("APIC objects %s not managed by the operator. Set spec.adoptExisting to take ownership", strings.Join(preExisting, ", ")))
+	segPol.Status.PreExisting = preExisting
+	segPol.Status.State = "Conflict"
+	meta.SetStatusCondition(&segPol.Status.Conditions, metav1.Condition{
+		Type:               ConditionPreExistingObjects,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonAdoptionRequired,
+		Message:            fmt.Sprintf("APIC objects %s are not managed by the operator. Set spec.adoptExisting to take ownership", strings.Join(preExisting, ", ")),
+		ObservedGeneration: segPol.Generation,
+	})
+	if err := r.Status().Update(ctx, segPol); err != nil {
+		return true, ctrl.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
+	}
+	policyStates.set(types.NamespacedName{Namespace: segPol.Namespace, Name: segPol.Name}, segPol.Status.State)
+	r.event(segPol, corev1.EventTypeWarning, ReasonAdoptionRequired,
+		fmt.Sprintf("APIC objects %s are not managed by the operator. Set spec.adoptExisting to take ownership", strings.Join(preExisting, ", ")))
+	return true, ctrl.Result{}, nil
+}
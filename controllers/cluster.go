@@ -0,0 +1,75 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+)
+
+// Clusters sharing the policy tenant are told apart by their cluster ID, stamped in the names and tags of their APIC objects:
+//   - Application Profile Seg_Pol_<tenant>_<cluster ID>
+//   - Contract, tags of the EPGs and filters <cluster ID>_<policy>
+//   - Filters <cluster ID>_<policy>_<eth><ip><port>
+// Without cluster ID the names are not stamped. Kubernetes names cannot contain '_', so objects of other clusters are never mistaken
+// for objects of this cluster
+
+// Check that the cluster ID can be stamped in the APIC object names
+func ValidateClusterID(clusterID string) error {
+	if clusterID == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(clusterID); len(errs) > 0 {
+		return fmt.Errorf("invalid cluster ID %s: %s", clusterID, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Application Profile of the EPGs of the cluster
+func appProfileName(clusterID, tenantName string) string {
+	if clusterID == "" {
+		return fmt.Sprintf(ApplicationProfileNamePrefix, tenantName)
+	}
+	return fmt.Sprintf(ApplicationProfileNamePrefix+"_%s", tenantName, clusterID)
+}
+
+// Name of the contract of the SegmentationPolicy, also used as key and value of the tags of its EPGs and filters
+func policyObjectName(clusterID, policy string) string {
+	if clusterID == "" {
+		return policy
+	}
+	return fmt.Sprintf("%s_%s", clusterID, policy)
+}
+
+// Filter of a rule of the SegmentationPolicy
+func ruleFilterName(clusterID, policy string, rule v1alpha1.RuleSpec) string {
+	return fmt.Sprintf("%s_%s%s%s", policyObjectName(clusterID, policy), rule.Eth, rule.IP, strconv.Itoa(rule.Port))
+}
+
+// SegmentationPolicy of a contract name or tag key. It returns false for the objects of other clusters
+func ownerPolicy(clusterID, name string) (string, bool) {
+	if clusterID == "" {
+		return name, !strings.Contains(name, "_")
+	}
+	policy := strings.TrimPrefix(name, clusterID+"_")
+	return policy, policy != name && !strings.Contains(policy, "_")
+}
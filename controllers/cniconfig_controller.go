@@ -0,0 +1,279 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/cni"
+	"github.com/jgomezve/aci-k8s-operator/pkg/utils"
+)
+
+const (
+	// ConfigMap deployed by the ACI CNI
+	CniConfigMapName      = "aci-containers-config"
+	CniConfigMapNamespace = "aci-containers-system"
+	// Condition of the SegmentationPolicies reporting whether the ACI CNI configuration is valid
+	ConditionCniConfigValid = "CniConfigValid"
+)
+
+// Read the ACI CNI configuration from the ConfigMap aci-containers-config. Invalid or missing keys are reported in cni.ParseErrors
+func ParseCniConfig(configMap *corev1.ConfigMap) (AciCniConfig, error) {
+	config, err := cni.Parse(configMap.Data)
+	if err != nil {
+		return AciCniConfig{}, fmt.Errorf("invalid ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+	return AciCniConfig{
+		ApicHosts:                     config.ApicHosts,
+		ApicUsername:                  config.ApicUsername,
+		KeyPath:                       config.PrivateKeyPath,
+		PolicyTenant:                  config.PolicyTenant,
+		PodBridgeDomain:               config.PodBridgeDomain,
+		KubernetesVmmDomain:           config.VmmDomain,
+		ApplicationProfileKubeDefault: config.DefaultApplicationProfile,
+		EPGKubeDefault:                config.DefaultEndpointGroup,
+	}, nil
+}
+
+// Check that all the parameters required to configure the APIC are set
+func (c AciCniConfig) Validate() error {
+	missing := []string{}
+	if len(c.ApicHosts) == 0 {
+		missing = append(missing, "APIC hosts")
+	}
+	if c.PolicyTenant == "" {
+		missing = append(missing, "policy tenant")
+	}
+	if c.PodBridgeDomain == "" {
+		missing = append(missing, "pod bridge domain")
+	}
+	if c.KubernetesVmmDomain == "" {
+		missing = append(missing, "VMM domain")
+	}
+	if c.ApplicationProfileKubeDefault == "" {
+		missing = append(missing, "default application profile")
+	}
+	if c.EPGKubeDefault == "" {
+		missing = append(missing, "default EPG")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing ACI parameters: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Whether the changes between both configurations require the SegmentationPolicies to be reconciled again. The APIC objects of the
+// policies are created in the new policy tenant, the ones of the previous tenant are neither moved nor deleted
+func (c AciCniConfig) policiesChanged(other AciCniConfig) bool {
+	return c.PolicyTenant != other.PolicyTenant ||
+		c.PodBridgeDomain != other.PodBridgeDomain ||
+		c.KubernetesVmmDomain != other.KubernetesVmmDomain ||
+		c.ApplicationProfileKubeDefault != other.ApplicationProfileKubeDefault ||
+		c.EPGKubeDefault != other.EPGKubeDefault ||
+		!hostsEqual(c.ApicHosts, other.ApicHosts)
+}
+
+// Whether the APIC user changed, so that the APIC client must login again with the new credentials
+func (c AciCniConfig) userChanged(other AciCniConfig) bool {
+	return c.ApicUsername != other.ApicUsername || c.KeyPath != other.KeyPath
+}
+
+func hostsEqual(a, b []string) bool {
+	return len(a) == len(b) && len(utils.Unique(a, b)) == 0 && len(utils.Unique(b, a)) == 0
+}
+
+// Source of the ACI parameters of the cluster
+type CniConfigProvider interface {
+	Load(ctx context.Context) (AciCniConfig, error)
+}
+
+// Provider whose parameters are stored in a Kubernetes object. The CniConfigReconciler loads the parameters again when the object changes
+type WatchedCniConfigProvider interface {
+	CniConfigProvider
+	// Object to watch. Only its name and namespace are set
+	Object() client.Object
+}
+
+// Parameters discovered from the ConfigMap deployed by the ACI CNI
+type AciCniConfigMapProvider struct {
+	Reader client.Reader
+}
+
+// Errors reading the ConfigMap from the Kubernetes API are returned as they are, so that they can be retried
+func (p *AciCniConfigMapProvider) Load(ctx context.Context) (AciCniConfig, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := p.Reader.Get(ctx, client.ObjectKeyFromObject(p.Object()), configMap); err != nil {
+		if errors.IsNotFound(err) {
+			return AciCniConfig{}, fmt.Errorf("ConfigMap %s/%s not found", CniConfigMapNamespace, CniConfigMapName)
+		}
+		return AciCniConfig{}, err
+	}
+	return ParseCniConfig(configMap)
+}
+
+func (p *AciCniConfigMapProvider) Object() client.Object {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: CniConfigMapNamespace, Name: CniConfigMapName}}
+}
+
+// Parameters set explicitly in the configuration file, environment variables or flags. Used with other CNIs or in lab environments
+type StaticCniConfigProvider struct {
+	Config AciCniConfig
+}
+
+func (p *StaticCniConfigProvider) Load(_ context.Context) (AciCniConfig, error) {
+	return p.Config, p.Config.Validate()
+}
+
+// ACI CNI configuration shared by the controllers. The error is set while the configuration is not valid
+type CniConfigStore struct {
+	lock   sync.RWMutex
+	config AciCniConfig
+	err    error
+}
+
+func NewCniConfigStore(config AciCniConfig, err error) *CniConfigStore {
+	return &CniConfigStore{config: config, err: err}
+}
+
+func (s *CniConfigStore) Get() (AciCniConfig, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.config, s.err
+}
+
+// Readiness check reporting whether the ACI CNI configuration is valid
+func (s *CniConfigStore) ReadyzCheck(_ *http.Request) error {
+	_, err := s.Get()
+	return err
+}
+
+// Replace the configuration. The error is set while the configuration is not valid or not usable (e.g. the APIC rejects the login)
+func (s *CniConfigStore) Set(config AciCniConfig, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.config, s.err = config, err
+}
+
+// APIC client whose cluster and credentials can be replaced
+type ApicConnection interface {
+	// Login to the new APIC cluster with the credentials of the current configuration
+	SetHosts(hosts []string) error
+	// Login again if the credentials of the current configuration changed
+	ReloadCredentials(ctx context.Context) (bool, error)
+}
+
+// CniConfigReconciler watches the source of the ACI parameters (e.g. ACI CNI ConfigMap), points the APIC client to the configured APICs and
+// reconciles all the SegmentationPolicies again when the configuration changes
+type CniConfigReconciler struct {
+	client.Client
+	Provider   WatchedCniConfigProvider
+	CniConfig  *CniConfigStore
+	ApicClient ApicConnection
+	Events     chan<- event.GenericEvent
+	Watchdog   *ReconcileWatchdog
+}
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+
+func (r *CniConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	defer r.Watchdog.Start(fmt.Sprintf("ConfigMap %s", req.NamespacedName))()
+
+	current, currentErr := r.CniConfig.Get()
+	cniConf, err := r.Provider.Load(ctx)
+	if _, ok := err.(errors.APIStatus); ok {
+		return ctrl.Result{}, err
+	}
+
+	// Login again if the previous configuration was not usable, the APIC cluster may be reachable now. The credentials are resolved from
+	// the new configuration (e.g. username), so it is stored before the login. The reconciles wait for the login
+	var loginErr error
+	if err == nil && (!hostsEqual(cniConf.ApicHosts, current.ApicHosts) || currentErr != nil) {
+		logger.Info(fmt.Sprintf("Connecting to the APIC controllers %s", strings.Join(cniConf.ApicHosts, ", ")))
+		r.CniConfig.Set(cniConf, fmt.Errorf("connecting to the APIC controllers %s", strings.Join(cniConf.ApicHosts, ", ")))
+		if loginErr = r.ApicClient.SetHosts(cniConf.ApicHosts); loginErr != nil {
+			err = fmt.Errorf("unable to login to the APIC controllers %s: %w", strings.Join(cniConf.ApicHosts, ", "), loginErr)
+		}
+	} else if err == nil && cniConf.userChanged(current) {
+		logger.Info(fmt.Sprintf("Logging in to the APIC controllers as %s", cniConf.ApicUsername))
+		r.CniConfig.Set(cniConf, fmt.Errorf("logging in to the APIC controllers as %s", cniConf.ApicUsername))
+		if _, loginErr = r.ApicClient.ReloadCredentials(ctx); loginErr != nil {
+			err = fmt.Errorf("unable to login to the APIC controllers as %s: %w", cniConf.ApicUsername, loginErr)
+		}
+	}
+	if err != nil {
+		logger.Error(err, "Invalid ACI CNI configuration")
+	}
+	r.CniConfig.Set(cniConf, err)
+
+	if err == nil && current.PolicyTenant != "" && cniConf.PolicyTenant != current.PolicyTenant {
+		logger.Info(fmt.Sprintf("WARNING: policy tenant changed from %s to %s. The APIC objects of the SegmentationPolicies in tenant %s are neither moved nor deleted",
+			current.PolicyTenant, cniConf.PolicyTenant, current.PolicyTenant))
+	}
+	if (err == nil) != (currentErr == nil) || (err == nil && cniConf.policiesChanged(current)) {
+		logger.Info(fmt.Sprintf("ACI CNI configuration changed for tenant %s. Reconciling all the SegmentationPolicies", cniConf.PolicyTenant))
+		r.reconcilePolicies(ctx)
+	}
+	// Retry the login to the APIC cluster. Invalid configurations wait for the next change of the ConfigMap
+	return ctrl.Result{}, loginErr
+}
+
+// Request the reconcile of all the SegmentationPolicies. The events are sent asynchronously, so the reconcile never waits for the
+// SegmentationPolicy controller, which may not consume them (e.g. while it waits for the leader election). The context of the reconcile
+// is the one of the controller, only cancelled when the manager stops
+func (r *CniConfigReconciler) reconcilePolicies(ctx context.Context) {
+	policies := &v1alpha1.SegmentationPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list the SegmentationPolicies")
+		return
+	}
+	go func() {
+		for i := range policies.Items {
+			select {
+			case r.Events <- event.GenericEvent{Object: &policies.Items[i]}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CniConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	watched := r.Provider.Object()
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("cniconfig").
+		For(watched).
+		WithEventFilter(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return object.GetNamespace() == watched.GetNamespace() && object.GetName() == watched.GetName()
+		})).
+		Complete(r)
+}
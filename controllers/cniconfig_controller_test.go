@@ -0,0 +1,122 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SegmentationPolicies are blocked while the ACI CNI configuration is not valid, and reconciled once it is fixed
+
+var _ = Describe("ACI CNI configuration controller", func() {
+	const (
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	// The configuration matches the one used by the Manager of the test suite. The VMM Domain is missing in the invalid one
+	validControllerConfig := `{"apic-hosts": ["10.0.0.1"], "apic-username": "k8s-user", "aci-policy-tenant": "my-test-tenant",
+		"aci-podbd-dn": "uni/tn-my-test-tenant/BD-my-test-bd", "aci-vmm-domain": "my-test-k8s-vmm"}`
+	invalidControllerConfig := `{"apic-hosts": ["10.0.0.1"], "apic-username": "k8s-user", "aci-policy-tenant": "my-test-tenant",
+		"aci-podbd-dn": "uni/tn-my-test-tenant/BD-my-test-bd"}`
+	hostAgentConfig := `{"app-profile": "my-test-app", "default-endpoint-group": {"name": "my-test-tenant|my-test-epg"}}`
+
+	cniConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CniConfigMapName,
+			Namespace: CniConfigMapNamespace,
+		},
+		Data: map[string]string{
+			"controller-config": invalidControllerConfig,
+			"host-agent-config": hostAgentConfig,
+		},
+	}
+
+	segPolCni := &v1alpha1.SegmentationPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apic.aci.cisco/v1alpha1",
+			Kind:       "SegmentationPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "segpol-cni",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SegmentationPolicySpec{
+			Namespaces: []string{"ns-cni"},
+			Rules: []v1alpha1.RuleSpec{
+				{
+					Eth:  "ip",
+					IP:   "udp",
+					Port: 53,
+				},
+			},
+		},
+	}
+	segPolLookupKey := types.NamespacedName{Name: segPolCni.Name, Namespace: segPolCni.Namespace}
+
+	Context("When the ACI CNI configuration changes", func() {
+
+		It("Should block the Segmentation Policies until the configuration is valid", func() {
+			By("Creating an invalid ACI CNI ConfigMap", func() {
+				Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: CniConfigMapNamespace}})).Should(Succeed())
+				Expect(k8sClient.Create(ctx, cniConfigMap)).Should(Succeed())
+			})
+			By("Creating a new K8s Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPolCni)).Should(Succeed())
+			})
+			By("Checking the Segmentation Policy is blocked", func() {
+				Eventually(func() bool {
+					segPol := &v1alpha1.SegmentationPolicy{}
+					if err := k8sClient.Get(ctx, segPolLookupKey, segPol); err != nil {
+						return false
+					}
+					return segPol.Status.State == "Blocked" && meta.IsStatusConditionFalse(segPol.Status.Conditions, ConditionCniConfigValid)
+				}, timeout, interval).Should(BeTrue())
+			})
+			By("Fixing the ACI CNI ConfigMap", func() {
+				configMap := &corev1.ConfigMap{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: CniConfigMapName, Namespace: CniConfigMapNamespace}, configMap)).Should(Succeed())
+				configMap.Data["controller-config"] = validControllerConfig
+				Expect(k8sClient.Update(ctx, configMap)).Should(Succeed())
+			})
+			By("Checking the Segmentation Policy is enforced", func() {
+				Eventually(func() bool {
+					segPol := &v1alpha1.SegmentationPolicy{}
+					if err := k8sClient.Get(ctx, segPolLookupKey, segPol); err != nil {
+						return false
+					}
+					return segPol.Status.State == "Enforced" && meta.IsStatusConditionTrue(segPol.Status.Conditions, ConditionCniConfigValid)
+				}, timeout, interval).Should(BeTrue())
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPolCni)).Should(Succeed())
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, segPolLookupKey, &v1alpha1.SegmentationPolicy{})
+					return err != nil
+				}, timeout, interval).Should(BeTrue())
+			})
+		})
+	})
+})
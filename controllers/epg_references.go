@@ -0,0 +1,90 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+	"github.com/jgomezve/aci-k8s-operator/pkg/utils"
+)
+
+// The EPG of a Namespace is shared by all the SegmentationPolicies listing the Namespace. Its references are counted from the
+// SegmentationPolicies stored in Kubernetes, so the tags added to the EPG by others (e.g. an APIC administrator) never change whether
+// it is deleted
+
+// EPGs attached to the SegmentationPolicy: the ones recorded in its status and, for policies reconciled before the status was
+// recorded, the ones tagged by the policy on the APIC
+func (r *SegmentationPolicyReconciler) attachedEpgs(ctx context.Context, cniConf AciCniConfig, segPol *v1alpha1.SegmentationPolicy) ([]string, error) {
+	tagged, err := r.apic(ctx).GetEpgWithAnnotation(appProfileName(r.ClusterID, cniConf.PolicyTenant), cniConf.PolicyTenant, policyObjectName(r.ClusterID, segPol.Name))
+	if err != nil {
+		return nil, fmt.Errorf("error occurred while reading the EPGs attached to Policy %s: %w", segPol.Name, err)
+	}
+	epgs := append([]string{}, segPol.Status.EndpointGroups...)
+	return append(epgs, utils.Unique(epgs, tagged)...), nil
+}
+
+// Other SegmentationPolicies referencing the EPG of the Namespace: the ones which attached it on the APIC and the ones which will
+// attach it, unless they are being deleted
+func (r *SegmentationPolicyReconciler) epgReferences(ctx context.Context, epg string, segPol *v1alpha1.SegmentationPolicy) ([]string, error) {
+	policies := &v1alpha1.SegmentationPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		return nil, fmt.Errorf("error occurred while counting the references of EPG %s: %w", epg, err)
+	}
+	references := []string{}
+	for _, pol := range policies.Items {
+		if pol.Namespace == segPol.Namespace && pol.Name == segPol.Name {
+			continue
+		}
+		if referencesEpg(&pol, epg) {
+			references = append(references, fmt.Sprintf("%s/%s", pol.Namespace, pol.Name))
+		}
+	}
+	return references, nil
+}
+
+// Whether the SegmentationPolicy attached the EPG on the APIC or will attach it
+func referencesEpg(pol *v1alpha1.SegmentationPolicy, epg string) bool {
+	return utils.Contains(pol.Status.EndpointGroups, epg) || (pol.GetDeletionTimestamp().IsZero() && utils.Contains(pol.Spec.Namespaces, epg))
+}
+
+// Add to the Application Profile MO the detachment of the EPG from the SegmentationPolicy. The EPG is deleted if no other policy
+// references it. Otherwise only the tag of the policy is removed and the EPG stops consuming/providing its contract. It returns true
+// if the EPG is deleted
+func (r *SegmentationPolicyReconciler) detachEpg(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPol *v1alpha1.SegmentationPolicy, appMo *aci.ManagedObject, epg string) (bool, error) {
+	references, err := r.epgReferences(ctx, epg, segPol)
+	if err != nil {
+		return false, err
+	}
+	if len(references) == 0 {
+		logger.Info(fmt.Sprintf("Deleting EPG  %s", epg))
+		appMo.AddChild(aci.EndpointGroupRefMo(epg).Deleted())
+		return true, nil
+	}
+	polName := policyObjectName(r.ClusterID, segPol.Name)
+	logger.Info(fmt.Sprintf("Removing annotation %s from EPG %s, still referenced by %s", polName, epg, joinNames(references)))
+	epgMo := aci.EndpointGroupRefMo(epg).AddChild(aci.TagAnnotationMo(polName, polName).Deleted())
+	if err := r.removeEpgContracts(ctx, logger, cniConf, epgMo, epg, polName); err != nil {
+		return false, err
+	}
+	appMo.AddChild(epgMo)
+	return false, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+// Annotations of the Namespaces setting the EPG settings. Only "true" enables a setting, Namespaces without the annotation use the
+// default of the APIC
+const (
+	AnnotationIntraEpgIsolation = "apic.aci.cisco/intra-epg-isolation"
+	AnnotationPreferredGroup    = "apic.aci.cisco/preferred-group"
+	AnnotationFloodOnEncap      = "apic.aci.cisco/flood-on-encap"
+)
+
+// Annotation of the Namespaces recording the EPG settings enabled by the Operator, as a comma-separated list of the setting
+// annotations without their prefix. Only these settings are reverted once their annotation is removed
+const AnnotationManagedEpgSettings = "apic.aci.cisco/managed-epg-settings"
+
+func epgSettingName(annotation string) string {
+	return strings.TrimPrefix(annotation, "apic.aci.cisco/")
+}
+
+// EPG settings recorded as enabled by the Operator on the Namespace
+func managedEpgSettings(ns *corev1.Namespace) aci.EpgSettings {
+	managed := map[string]bool{}
+	for _, name := range strings.Split(ns.GetAnnotations()[AnnotationManagedEpgSettings], ",") {
+		managed[name] = true
+	}
+	return aci.EpgSettings{
+		IntraEpgIsolation: managed[epgSettingName(AnnotationIntraEpgIsolation)],
+		PreferredGroup:    managed[epgSettingName(AnnotationPreferredGroup)],
+		FloodOnEncap:      managed[epgSettingName(AnnotationFloodOnEncap)],
+	}
+}
+
+// Value of the AnnotationManagedEpgSettings annotation recording the enabled settings
+func managedEpgSettingsValue(settings aci.EpgSettings) string {
+	names := []string{}
+	if settings.IntraEpgIsolation {
+		names = append(names, epgSettingName(AnnotationIntraEpgIsolation))
+	}
+	if settings.PreferredGroup {
+		names = append(names, epgSettingName(AnnotationPreferredGroup))
+	}
+	if settings.FloodOnEncap {
+		names = append(names, epgSettingName(AnnotationFloodOnEncap))
+	}
+	return strings.Join(names, ",")
+}
+
+// EPG settings requested by the annotations of the Namespace
+func namespaceEpgSettings(ns *corev1.Namespace) aci.EpgSettings {
+	annotations := ns.GetAnnotations()
+	return aci.EpgSettings{
+		IntraEpgIsolation: annotations[AnnotationIntraEpgIsolation] == "true",
+		PreferredGroup:    annotations[AnnotationPreferredGroup] == "true",
+		FloodOnEncap:      annotations[AnnotationFloodOnEncap] == "true",
+	}
+}
+
+// Set the settings of the Namespace on the EPG MO. Existing EPGs are only modified if their settings on the APIC differ. Removed
+// annotations revert the setting to the default only if the Operator enabled it, settings changed on the APIC by other tools are
+// left untouched
+func (r *SegmentationPolicyReconciler) reconcileEpgSettings(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, epgMo *aci.ManagedObject, ns *corev1.Namespace, created bool) error {
+	desired := namespaceEpgSettings(ns)
+	if created {
+		if desired != (aci.EpgSettings{}) {
+			epgMo.WithEpgSettings(desired)
+		}
+		return nil
+	}
+	current, err := r.apic(ctx).GetEpgSettings(ns.Name, appProfileName(r.ClusterID, cniConf.PolicyTenant), cniConf.PolicyTenant)
+	if err != nil {
+		return fmt.Errorf("error occurred while reading the settings of EPG %s: %w", ns.Name, err)
+	}
+	managed := managedEpgSettings(ns)
+	settings := aci.EpgSettings{
+		IntraEpgIsolation: desired.IntraEpgIsolation || (current.IntraEpgIsolation && !managed.IntraEpgIsolation),
+		PreferredGroup:    desired.PreferredGroup || (current.PreferredGroup && !managed.PreferredGroup),
+		FloodOnEncap:      desired.FloodOnEncap || (current.FloodOnEncap && !managed.FloodOnEncap),
+	}
+	if current != settings {
+		logger.Info(fmt.Sprintf("Updating the settings of EPG %s: %+v", ns.Name, settings))
+		epgMo.WithEpgSettings(settings)
+	}
+	return nil
+}
+
+// Record on the Namespace the EPG settings enabled by the Operator once they are posted to the APIC
+func recordEpgSettings(ctx context.Context, c client.Client, nsName, value string) error {
+	annotation := fmt.Sprintf("%q", value)
+	if value == "" {
+		annotation = "null"
+	}
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{"%s": %s}}}`, AnnotationManagedEpgSettings, annotation))
+	ns := &corev1.Namespace{}
+	ns.Name = nsName
+	return client.IgnoreNotFound(c.Patch(ctx, ns, client.RawPatch(types.MergePatchType, patch)))
+}
+
+// Namespace updates changing the EPG settings. The generation of the Namespaces does not change with their annotations
+var epgSettingsChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNs, okOld := e.ObjectOld.(*corev1.Namespace)
+		newNs, okNew := e.ObjectNew.(*corev1.Namespace)
+		return okOld && okNew && namespaceEpgSettings(oldNs) != namespaceEpgSettings(newNs)
+	},
+}
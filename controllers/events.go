@@ -0,0 +1,114 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ciscoecosystem/aci-go-client/models"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+// Reasons of the Events emitted for the changes on the APIC
+const (
+	ReasonEpgCreated                 = "EpgCreated"
+	ReasonEpgDeleted                 = "EpgDeleted"
+	ReasonEpgUpdated                 = "EpgUpdated"
+	ReasonContractCreated            = "ContractCreated"
+	ReasonContractUpdated            = "ContractUpdated"
+	ReasonContractDeleted            = "ContractDeleted"
+	ReasonFiltersDeleted             = "FiltersDeleted"
+	ReasonNamespaceAnnotated         = "NamespaceAnnotated"
+	ReasonNamespaceAnnotationRemoved = "NamespaceAnnotationRemoved"
+	ReasonApicError                  = "ApicError"
+	ReasonApicObjectsRetained        = "ApicObjectsRetained"
+	ReasonApicObjectsOrphaned        = "ApicObjectsOrphaned"
+)
+
+// Emit an Event on the SegmentationPolicy. Nothing is emitted without a recorder
+func (r *SegmentationPolicyReconciler) event(segPol *v1alpha1.SegmentationPolicy, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Event(segPol, eventType, reason, message)
+}
+
+// Emit an Event on the SegmentationPolicy and the Namespace affected by the change
+func (r *SegmentationPolicyReconciler) namespaceEvent(ctx context.Context, segPol *v1alpha1.SegmentationPolicy, nsName, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Event(segPol, eventType, reason, message)
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: nsName}, ns); err != nil {
+		log.FromContext(ctx).Info(fmt.Sprintf("Unable to emit the Event %s on Namespace %s: %s", reason, nsName, err))
+		return
+	}
+	r.Recorder.Event(ns, eventType, reason, fmt.Sprintf("%s (SegmentationPolicy %s/%s)", message, segPol.Namespace, segPol.Name))
+}
+
+// Emit a Warning Event for a failed APIC operation
+func (r *SegmentationPolicyReconciler) apicErrorEvent(segPol *v1alpha1.SegmentationPolicy, err error) {
+	r.event(segPol, corev1.EventTypeWarning, ReasonApicError, err.Error())
+}
+
+// Emit the Events of the EPGs, filters and contracts deleted or updated by the configuration posted to the APIC
+func (r *SegmentationPolicyReconciler) postedConfigEvents(ctx context.Context, segPol *v1alpha1.SegmentationPolicy, tenantMo *aci.ManagedObject) {
+	polName := policyObjectName(r.ClusterID, segPol.Name)
+	deletedFilters := []string{}
+	for _, child := range tenantMo.Children {
+		switch child.ClassName {
+		case models.VzfilterClassName:
+			if child.IsDeleted() {
+				deletedFilters = append(deletedFilters, child.Attributes["name"])
+			}
+		case models.VzbrcpClassName:
+			if child.IsDeleted() {
+				r.event(segPol, corev1.EventTypeNormal, ReasonContractDeleted, fmt.Sprintf("Deleted Contract %s", child.Attributes["name"]))
+			}
+		case models.FvapClassName:
+			for _, epg := range child.Children {
+				if epg.ClassName != models.FvaepgClassName {
+					continue
+				}
+				if epg.IsDeleted() {
+					r.namespaceEvent(ctx, segPol, epg.Attributes["name"], corev1.EventTypeNormal, ReasonEpgDeleted, fmt.Sprintf("Deleted EPG %s", epg.Attributes["name"]))
+				} else if tag := epg.GetChild(models.TagAnnotationClassName, "key", polName); tag != nil && tag.IsDeleted() {
+					r.namespaceEvent(ctx, segPol, epg.Attributes["name"], corev1.EventTypeNormal, ReasonEpgUpdated,
+						fmt.Sprintf("EPG %s no longer consumes/provides Contract %s", epg.Attributes["name"], polName))
+				}
+			}
+		}
+	}
+	if len(deletedFilters) > 0 {
+		r.event(segPol, corev1.EventTypeNormal, ReasonFiltersDeleted, fmt.Sprintf("Deleted Filters %s", joinNames(deletedFilters)))
+	}
+}
+
+func joinNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ciscoecosystem/aci-go-client/models"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+// Value of the tags of the SegmentationPolicies deleted with the Orphan deletion policy. The garbage collector leaves their objects alone
+const OrphanedTagValue = "orphaned"
+
+// GarbageCollector periodically looks for the APIC objects of the policy tenant created by the operator for SegmentationPolicies which
+// no longer exist (e.g. after a crash or a failed cleanup): filters and EPGs tagged by the policy, and contracts annotated with
+// orchestrator:kubernetes. Objects whose tags were marked as orphaned by the Orphan deletion policy are skipped. Orphans are reported and, if enabled, deleted once they have been orphaned for the grace period
+type GarbageCollector struct {
+	client.Client
+	ApicClient aci.ApicInterface
+	CniConfig  *CniConfigStore
+	Interval   time.Duration
+	// Only the APIC objects stamped with the cluster ID are collected. Objects of other clusters sharing the tenant are ignored
+	ClusterID string
+	// Time an object must stay orphaned before it is deleted. It covers the policies whose creation is not yet seen by the operator
+	GracePeriod time.Duration
+	// Delete the orphans. Otherwise they are only reported
+	Delete bool
+
+	lock sync.Mutex
+	// Time each orphan was first found
+	firstSeen map[string]time.Time
+}
+
+// APIC object of deleted SegmentationPolicies
+type orphanedObject struct {
+	dn    string
+	class string
+	// Deleted SegmentationPolicies tagging the object
+	policies []string
+	// MO posted to the tenant removing the object, or only the tags if the object is also tagged by others
+	mo *aci.ManagedObject
+}
+
+// Run the collection every interval until the context is done
+func (g *GarbageCollector) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("garbage-collector")
+	logger.Info(fmt.Sprintf("Looking for orphaned APIC objects every %s", g.Interval))
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := g.Collect(log.IntoContext(ctx, logger)); err != nil {
+			logger.Error(err, "garbage collection failed")
+		}
+	}, g.Interval)
+	return nil
+}
+
+// Only the leader deletes APIC objects
+func (g *GarbageCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// Find the orphaned APIC objects and delete the ones orphaned for longer than the grace period
+func (g *GarbageCollector) Collect(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "GarbageCollector.Collect")
+	defer func() { endSpan(span, err) }()
+	logger := log.FromContext(ctx)
+
+	cniConf, err := g.CniConfig.Get()
+	if err != nil {
+		logger.Info(fmt.Sprintf("Invalid ACI CNI configuration, skipping the garbage collection: %s", err))
+		return nil
+	}
+	orphans, err := g.findOrphans(ctx, cniConf)
+	if err != nil {
+		return err
+	}
+
+	counts := map[string]int{models.VzfilterClassName: 0, models.FvaepgClassName: 0, models.VzbrcpClassName: 0}
+	expired := g.track(orphans, time.Now())
+	for _, orphan := range orphans {
+		counts[orphan.class]++
+		logger.Info(fmt.Sprintf("Orphaned APIC object %s of deleted Segmentation Policies %s", orphan.dn, strings.Join(orphan.policies, ", ")))
+	}
+	for class, count := range counts {
+		orphanedObjects.WithLabelValues(class).Set(float64(count))
+	}
+	if !g.Delete || len(expired) == 0 {
+		return nil
+	}
+
+	tenantMo := aci.TenantMo(cniConf.PolicyTenant)
+	appMo := aci.ApplicationProfileRefMo(appProfileName(g.ClusterID, cniConf.PolicyTenant))
+	for _, orphan := range expired {
+		if orphan.class == models.FvaepgClassName {
+			appMo.AddChild(orphan.mo)
+		} else {
+			tenantMo.AddChild(orphan.mo)
+		}
+	}
+	if len(appMo.Children) > 0 {
+		tenantMo.AddChild(appMo)
+	}
+	if err := apicWithContext(ctx, g.ApicClient).PostTenantConfig(tenantMo); err != nil {
+		return fmt.Errorf("error occurred while deleting the orphaned APIC objects: %w", err)
+	}
+	for _, orphan := range expired {
+		logger.Info(fmt.Sprintf("Deleted orphaned APIC object %s", orphan.dn))
+		collectedObjects.WithLabelValues(orphan.class).Inc()
+		// Pods of the Namespace are placed again in the default EPG
+		if orphan.class == models.FvaepgClassName && orphan.mo.IsDeleted() {
+			if err := removeEpgAnnotation(ctx, g.Client, orphan.mo.Attributes["name"]); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, fmt.Sprintf("unable to remove the EPG annotation of Namespace %s", orphan.mo.Attributes["name"]))
+			}
+		}
+	}
+	return nil
+}
+
+// Orphaned filters, EPGs and contracts of the policy tenant
+func (g *GarbageCollector) findOrphans(ctx context.Context, cniConf AciCniConfig) ([]orphanedObject, error) {
+	policies := &v1alpha1.SegmentationPolicyList{}
+	if err := g.List(ctx, policies); err != nil {
+		return nil, err
+	}
+	live := map[string]bool{}
+	for _, pol := range policies.Items {
+		live[pol.Name] = true
+	}
+
+	apic := apicWithContext(ctx, g.ApicClient)
+	tagged, err := apic.GetTaggedObjects(cniConf.PolicyTenant)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred while reading the tagged APIC objects: %w", err)
+	}
+	contracts, err := apic.GetManagedContracts(cniConf.PolicyTenant)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred while reading the APIC contracts: %w", err)
+	}
+
+	tenantDn := fmt.Sprintf("uni/tn-%s", cniConf.PolicyTenant)
+	appDn := fmt.Sprintf("%s/ap-%s", tenantDn, appProfileName(g.ClusterID, cniConf.PolicyTenant))
+	orphans := []orphanedObject{}
+	for dn, tags := range tagged {
+		// The operator tags the objects with the name of the policy as both key and value. The value of the tags of the policies deleted
+		// with the Orphan deletion policy is orphaned, so those objects are not collected
+		policies := []string{}
+		for key, value := range tags {
+			if policy, ok := ownerPolicy(g.ClusterID, key); ok && key == value && !live[policy] {
+				policies = append(policies, key)
+			}
+		}
+		if len(policies) == 0 {
+			continue
+		}
+		sort.Strings(policies)
+		// Objects also tagged by live policies (or by others) are kept, only the tags of the deleted policies are removed
+		shared := len(tags) > len(policies)
+		switch {
+		case strings.HasPrefix(dn, tenantDn+"/flt-"):
+			mo := aci.FilterRefMo(strings.TrimPrefix(dn, tenantDn+"/flt-"))
+			if shared {
+				for _, pol := range policies {
+					mo.AddChild(aci.TagAnnotationMo(pol, pol).Deleted())
+				}
+			} else {
+				mo.Deleted()
+			}
+			orphans = append(orphans, orphanedObject{dn: dn, class: models.VzfilterClassName, policies: policies, mo: mo})
+		case strings.HasPrefix(dn, appDn+"/epg-"):
+			mo := aci.EndpointGroupRefMo(strings.TrimPrefix(dn, appDn+"/epg-"))
+			if shared {
+				for _, pol := range policies {
+					mo.AddChild(aci.TagAnnotationMo(pol, pol).Deleted(), aci.ContractConsumerMo(pol).Deleted(), aci.ContractProviderMo(pol).Deleted())
+				}
+			} else {
+				mo.Deleted()
+			}
+			orphans = append(orphans, orphanedObject{dn: dn, class: models.FvaepgClassName, policies: policies, mo: mo})
+		}
+	}
+	for _, contract := range contracts {
+		dn := fmt.Sprintf("%s/brc-%s", tenantDn, contract)
+		if tagged[dn][contract] == OrphanedTagValue {
+			continue
+		}
+		if policy, ok := ownerPolicy(g.ClusterID, contract); ok && !live[policy] {
+			orphans = append(orphans, orphanedObject{dn: dn, class: models.VzbrcpClassName,
+				policies: []string{contract}, mo: aci.ContractRefMo(contract).Deleted()})
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].dn < orphans[j].dn })
+	return orphans, nil
+}
+
+// Record when each orphan was first found and return the ones orphaned for longer than the grace period. Objects no longer orphaned are forgotten
+func (g *GarbageCollector) track(orphans []orphanedObject, now time.Time) []orphanedObject {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	firstSeen := map[string]time.Time{}
+	expired := []orphanedObject{}
+	for _, orphan := range orphans {
+		first, ok := g.firstSeen[orphan.dn]
+		if !ok {
+			first = now
+		}
+		firstSeen[orphan.dn] = first
+		if now.Sub(first) >= g.GracePeriod {
+			expired = append(expired, orphan)
+		}
+	}
+	g.firstSeen = firstSeen
+	return expired
+}
@@ -0,0 +1,152 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+// APIC objects tagged by SegmentationPolicies which do not exist are deleted once the grace period expires
+
+var _ = Describe("Garbage collector", func() {
+	ctx := context.Background()
+	// Name of a SegmentationPolicy never created in the cluster
+	const orphanPolicy = "gcpol"
+
+	Context("When the APIC has objects of deleted Segmentation Policies", func() {
+		It("Should delete them after the grace period", func() {
+			filterName := fmt.Sprintf("%s_iptcp80", orphanPolicy)
+			gc := &GarbageCollector{
+				Client:      k8sClient,
+				ApicClient:  apicClient,
+				CniConfig:   NewCniConfigStore(cniConf, nil),
+				GracePeriod: time.Hour,
+				Delete:      true,
+			}
+			By("Creating the orphaned filter and contract on the APIC", func() {
+				Expect(apicClient.CreateFilterAndFilterEntry(cniConf.PolicyTenant, filterName, "ip", "tcp", 80)).Should(Succeed())
+				Expect(apicClient.AddTagAnnotationToFilter(filterName, cniConf.PolicyTenant, orphanPolicy, orphanPolicy)).Should(Succeed())
+				Expect(apicClient.CreateContract(cniConf.PolicyTenant, orphanPolicy, []string{filterName})).Should(Succeed())
+			})
+			By("Checking the orphans are kept during the grace period", func() {
+				Expect(gc.Collect(ctx)).Should(Succeed())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+				contracts, _ := apicClient.GetManagedContracts(cniConf.PolicyTenant)
+				Expect(contracts).Should(ContainElement(orphanPolicy))
+			})
+			By("Checking the orphans are deleted once the grace period expires", func() {
+				gc.GracePeriod = 0
+				Expect(gc.Collect(ctx)).Should(Succeed())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeFalse())
+				contracts, _ := apicClient.GetManagedContracts(cniConf.PolicyTenant)
+				Expect(contracts).ShouldNot(ContainElement(orphanPolicy))
+			})
+		})
+	})
+
+	Context("When the APIC has objects of another cluster", func() {
+		It("Should only collect the objects stamped with its cluster ID", func() {
+			owner := policyObjectName("cluster-b", orphanPolicy)
+			filterName := ruleFilterName("cluster-b", orphanPolicy, v1alpha1.RuleSpec{Eth: "ip", IP: "tcp", Port: 80})
+			gc := &GarbageCollector{
+				Client:     k8sClient,
+				ApicClient: apicClient,
+				CniConfig:  NewCniConfigStore(cniConf, nil),
+				Delete:     true,
+				ClusterID:  "cluster-a",
+			}
+			By("Creating the filter of the other cluster on the APIC", func() {
+				Expect(apicClient.CreateFilterAndFilterEntry(cniConf.PolicyTenant, filterName, "ip", "tcp", 80)).Should(Succeed())
+				Expect(apicClient.AddTagAnnotationToFilter(filterName, cniConf.PolicyTenant, owner, owner)).Should(Succeed())
+			})
+			By("Checking the filter is ignored by the garbage collector of this cluster", func() {
+				Expect(gc.Collect(ctx)).Should(Succeed())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+			})
+			By("Checking the filter is deleted by the garbage collector of its cluster", func() {
+				gc.ClusterID = "cluster-b"
+				Expect(gc.Collect(ctx)).Should(Succeed())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeFalse())
+			})
+		})
+	})
+
+	Context("When the APIC has objects of Segmentation Policies deleted with the Orphan deletion policy", func() {
+		It("Should leave them alone", func() {
+			const orphanedPolicy = "gcorphan"
+			filterName := fmt.Sprintf("%s_iptcp80", orphanedPolicy)
+			gc := &GarbageCollector{
+				Client:     k8sClient,
+				ApicClient: apicClient,
+				CniConfig:  NewCniConfigStore(cniConf, nil),
+				Delete:     true,
+			}
+			By("Creating the filter and contract marked as orphaned on the APIC", func() {
+				Expect(apicClient.CreateFilterAndFilterEntry(cniConf.PolicyTenant, filterName, "ip", "tcp", 80)).Should(Succeed())
+				Expect(apicClient.AddTagAnnotationToFilter(filterName, cniConf.PolicyTenant, orphanedPolicy, OrphanedTagValue)).Should(Succeed())
+				Expect(apicClient.CreateContract(cniConf.PolicyTenant, orphanedPolicy, []string{filterName})).Should(Succeed())
+				tenantMo := aci.TenantMo(cniConf.PolicyTenant).AddChild(aci.ContractRefMo(orphanedPolicy).AddChild(aci.TagAnnotationMo(orphanedPolicy, OrphanedTagValue)))
+				Expect(apicClient.PostTenantConfig(tenantMo)).Should(Succeed())
+			})
+			By("Checking the objects are kept", func() {
+				Expect(gc.Collect(ctx)).Should(Succeed())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+				contracts, _ := apicClient.GetManagedContracts(cniConf.PolicyTenant)
+				Expect(contracts).Should(ContainElement(orphanedPolicy))
+			})
+		})
+	})
+
+	// There is no migration between cluster IDs: the objects created with the previous ID are left to the operator
+	Context("When the cluster ID of the Operator changes", func() {
+		It("Should not collect the objects created with the previous cluster ID", func() {
+			filterName := ruleFilterName("", orphanPolicy, v1alpha1.RuleSpec{Eth: "ip", IP: "udp", Port: 53})
+			gc := &GarbageCollector{
+				Client:     k8sClient,
+				ApicClient: apicClient,
+				CniConfig:  NewCniConfigStore(cniConf, nil),
+				Delete:     true,
+				ClusterID:  "cluster-a",
+			}
+			By("Creating the filter of a deleted policy without cluster ID on the APIC", func() {
+				Expect(apicClient.CreateFilterAndFilterEntry(cniConf.PolicyTenant, filterName, "ip", "udp", 53)).Should(Succeed())
+				Expect(apicClient.AddTagAnnotationToFilter(filterName, cniConf.PolicyTenant, orphanPolicy, orphanPolicy)).Should(Succeed())
+			})
+			By("Checking the filter is ignored once the cluster ID is set", func() {
+				Expect(gc.Collect(ctx)).Should(Succeed())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+			})
+			By("Checking the filter is only collected without cluster ID", func() {
+				gc.ClusterID = ""
+				Expect(gc.Collect(ctx)).Should(Succeed())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeFalse())
+			})
+		})
+	})
+})
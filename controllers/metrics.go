@@ -0,0 +1,218 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ciscoecosystem/aci-go-client/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+var (
+	// SegmentationPolicies per state (Creating, Enforced, Blocked, ...)
+	segPolStates = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "segmentationpolicy_state",
+			Help: "Number of SegmentationPolicies in each state",
+		},
+		[]string{"state"},
+	)
+	// APIC objects managed by each SegmentationPolicy
+	segPolManagedObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "segmentationpolicy_managed_objects",
+			Help: "Number of APIC objects (epg, filter, contract) managed by the SegmentationPolicy",
+		},
+		[]string{"namespace", "name", "kind"},
+	)
+	// APIC objects re-created or removed by the reconcile because they diverged from the last applied desired state of the SegmentationPolicy
+	segPolDrift = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "segmentationpolicy_drift_objects_total",
+			Help: "Number of APIC objects re-created or removed because they diverged from the last applied state of the SegmentationPolicy, by APIC class",
+		},
+		[]string{"namespace", "name", "class"},
+	)
+	segPolLastSync = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "segmentationpolicy_last_sync_timestamp_seconds",
+			Help: "Time of the last successful sync of the SegmentationPolicy with the APIC in unix seconds",
+		},
+		[]string{"namespace", "name"},
+	)
+	// APIC objects of deleted SegmentationPolicies found by the garbage collector
+	orphanedObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "segmentationpolicy_orphaned_apic_objects",
+			Help: "Number of APIC objects of deleted SegmentationPolicies found by the last garbage collection, by APIC class",
+		},
+		[]string{"class"},
+	)
+	collectedObjects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "segmentationpolicy_collected_apic_objects_total",
+			Help: "Number of orphaned APIC objects deleted (or untagged, if shared) by the garbage collector, by APIC class",
+		},
+		[]string{"class"},
+	)
+
+	policyStates = &policyStateTracker{
+		states:       map[types.NamespacedName]string{},
+		driftClasses: map[types.NamespacedName]map[string]bool{},
+		applied:      map[types.NamespacedName]string{},
+	}
+)
+
+func init() {
+	metrics.Registry.MustRegister(segPolStates, segPolManagedObjects, segPolDrift, segPolLastSync, orphanedObjects, collectedObjects)
+}
+
+// Last state of every SegmentationPolicy, used to compute the number of policies per state, and the drift labels to remove once the policy is deleted
+type policyStateTracker struct {
+	lock         sync.Mutex
+	states       map[types.NamespacedName]string
+	driftClasses map[types.NamespacedName]map[string]bool
+	// Desired state of the last successful sync of each policy
+	applied map[types.NamespacedName]string
+}
+
+func (t *policyStateTracker) set(key types.NamespacedName, state string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if previous, ok := t.states[key]; ok {
+		segPolStates.WithLabelValues(previous).Dec()
+	}
+	t.states[key] = state
+	segPolStates.WithLabelValues(state).Inc()
+}
+
+func (t *policyStateTracker) addDrift(key types.NamespacedName, class string, count int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.driftClasses[key] == nil {
+		t.driftClasses[key] = map[string]bool{}
+	}
+	t.driftClasses[key][class] = true
+	segPolDrift.WithLabelValues(key.Namespace, key.Name, class).Add(float64(count))
+}
+
+func (t *policyStateTracker) delete(key types.NamespacedName) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if previous, ok := t.states[key]; ok {
+		segPolStates.WithLabelValues(previous).Dec()
+		delete(t.states, key)
+	}
+	for class := range t.driftClasses[key] {
+		segPolDrift.DeleteLabelValues(key.Namespace, key.Name, class)
+	}
+	delete(t.driftClasses, key)
+	delete(t.applied, key)
+}
+
+// Replace the desired state applied by the last successful sync of the policy. It returns the previous one, if any
+func (t *policyStateTracker) swapApplied(key types.NamespacedName, desired string) (string, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	previous, ok := t.applied[key]
+	t.applied[key] = desired
+	return previous, ok
+}
+
+// Record the objects managed by the SegmentationPolicy and the objects repaired on the APIC by a successful sync. The desired state
+// identifies the inputs of the sync (spec, Namespaces, ACI CNI configuration): objects are only counted as drift if it did not change
+// since the previous sync, otherwise the changes on the APIC are the ones requested
+func recordPolicySync(segPol *v1alpha1.SegmentationPolicy, desired string, tenantMo *aci.ManagedObject) {
+	epgs := 0
+	filters := map[string]bool{}
+	for _, child := range tenantMo.Children {
+		switch {
+		case child.ClassName == models.FvapClassName:
+			for _, epg := range child.Children {
+				if epg.ClassName == models.FvaepgClassName && !epg.IsDeleted() {
+					epgs++
+				}
+			}
+		case child.ClassName == models.VzfilterClassName && !child.IsDeleted():
+			filters[child.Attributes["name"]] = true
+		}
+	}
+	segPolManagedObjects.WithLabelValues(segPol.Namespace, segPol.Name, "epg").Set(float64(epgs))
+	segPolManagedObjects.WithLabelValues(segPol.Namespace, segPol.Name, "filter").Set(float64(len(filters)))
+	segPolManagedObjects.WithLabelValues(segPol.Namespace, segPol.Name, "contract").Set(1)
+	key := types.NamespacedName{Namespace: segPol.Namespace, Name: segPol.Name}
+	if previous, ok := policyStates.swapApplied(key, desired); ok && previous == desired {
+		for class, count := range driftObjects(tenantMo, map[string]int{}) {
+			policyStates.addDrift(key, class, count)
+		}
+	}
+	segPolLastSync.WithLabelValues(segPol.Namespace, segPol.Name).Set(float64(time.Now().Unix()))
+}
+
+// Inputs of the sync of a SegmentationPolicy: the generation of its spec, the EPGs of its Namespaces and the ACI CNI configuration
+func desiredState(segPol *v1alpha1.SegmentationPolicy, cniConf AciCniConfig, epgs []string) string {
+	sorted := append([]string{}, epgs...)
+	sort.Strings(sorted)
+	return fmt.Sprintf("%d|%s|%s|%s/%s", segPol.Generation, strings.Join(sorted, ","), cniConf.PolicyTenant, cniConf.ApplicationProfileKubeDefault, cniConf.EPGKubeDefault)
+}
+
+// Remove the metrics of a deleted SegmentationPolicy
+func forgetPolicyMetrics(key types.NamespacedName) {
+	policyStates.delete(key)
+	for _, kind := range []string{"epg", "filter", "contract"} {
+		segPolManagedObjects.DeleteLabelValues(key.Namespace, key.Name, kind)
+	}
+	segPolLastSync.DeleteLabelValues(key.Namespace, key.Name)
+}
+
+// Number of MOs of the tree which repair the APIC, by class: the deleted MOs, the EPGs created again and the contract relations of the
+// EPGs, which are only posted if they are missing on the APIC. The other MOs are posted on every sync
+func driftObjects(mo *aci.ManagedObject, counts map[string]int) map[string]int {
+	switch {
+	case mo.IsDeleted():
+		counts[mo.ClassName]++
+		return counts
+	case mo.ClassName == models.FvaepgClassName && hasChildOfClass(mo, "fvRsBd"):
+		counts[mo.ClassName]++
+		return counts
+	case mo.ClassName == models.FvrsconsClassName || mo.ClassName == models.FvrsprovClassName || mo.ClassName == "fvRsSecInherited":
+		counts[mo.ClassName]++
+	}
+	for _, child := range mo.Children {
+		driftObjects(child, counts)
+	}
+	return counts
+}
+
+func hasChildOfClass(mo *aci.ManagedObject, className string) bool {
+	for _, child := range mo.Children {
+		if child.ClassName == className {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+// Only the objects repaired while the desired state of the policy is unchanged are counted as drift
+
+var _ = Describe("SegmentationPolicy metrics", func() {
+	Context("When a Segmentation Policy is synced", func() {
+		It("Should only count the drift of an unchanged desired state", func() {
+			segPol := &v1alpha1.SegmentationPolicy{ObjectMeta: metav1.ObjectMeta{Name: "segpol-metrics", Namespace: "default"}}
+			key := types.NamespacedName{Namespace: segPol.Namespace, Name: segPol.Name}
+			defer forgetPolicyMetrics(key)
+			tenantMo := func() *aci.ManagedObject {
+				return aci.TenantMo("k8s").
+					AddChild(aci.ApplicationProfileRefMo("Seg_Pol_k8s").AddChild(aci.EndpointGroupRefMo("ns-a").AddChild(aci.ContractConsumerMo("segpol-metrics")))).
+					AddChild(aci.FilterMo("segpol-metrics_iptcp80", "ip", "tcp", 80)).
+					AddChild(aci.FilterMo("segpol-metrics_iptcp80", "ip", "tcp", 80)).
+					AddChild(aci.FilterRefMo("segpol-metrics_iptcp443").Deleted())
+			}
+			drift := func(class string) float64 {
+				return testutil.ToFloat64(segPolDrift.WithLabelValues(key.Namespace, key.Name, class))
+			}
+			By("Syncing a new desired state", func() {
+				recordPolicySync(segPol, "1|ns-a", tenantMo())
+				Expect(drift("vzFilter")).Should(BeZero())
+				Expect(drift("fvRsCons")).Should(BeZero())
+				Expect(testutil.ToFloat64(segPolManagedObjects.WithLabelValues(key.Namespace, key.Name, "filter"))).Should(Equal(1.0))
+				Expect(testutil.ToFloat64(segPolManagedObjects.WithLabelValues(key.Namespace, key.Name, "epg"))).Should(Equal(1.0))
+			})
+			By("Syncing the same desired state", func() {
+				recordPolicySync(segPol, "1|ns-a", tenantMo())
+				Expect(drift("vzFilter")).Should(Equal(1.0))
+				Expect(drift("fvRsCons")).Should(Equal(1.0))
+			})
+			By("Syncing a changed desired state", func() {
+				recordPolicySync(segPol, "2|ns-a", tenantMo())
+				Expect(drift("vzFilter")).Should(Equal(1.0))
+				Expect(drift("fvRsCons")).Should(Equal(1.0))
+			})
+		})
+	})
+})
@@ -0,0 +1,181 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+	"github.com/jgomezve/aci-k8s-operator/pkg/utils"
+)
+
+// NamespaceEndpointGroupReconciler reflects the EPG of each Namespace on the APIC in a NamespaceEndpointGroup. The EPGs are configured
+// on the APIC by the SegmentationPolicies referencing them, in the same transaction as their contracts. The NamespaceEndpointGroup is
+// created with the EPG and deleted once the EPG no longer exists and no SegmentationPolicy references it. It is read-only: the lifecycle of
+// the EPG is owned by the SegmentationPolicies, so neither editing nor deleting the NamespaceEndpointGroup modifies the EPG. A deleted
+// NamespaceEndpointGroup is created again by the next reconcile of a SegmentationPolicy referencing the EPG
+type NamespaceEndpointGroupReconciler struct {
+	client.Client
+	ApicClient aci.ApicInterface
+	CniConfig  *CniConfigStore
+	ClusterID  string
+	Watchdog   *ReconcileWatchdog
+	// Interval between the reads of the EPG from the APIC, which catch the changes made outside of the operator. 0 disables them
+	ResyncInterval time.Duration
+}
+
+const (
+	EpgStateCreated = "Created"
+	EpgStateMissing = "Missing"
+)
+
+// Interval between the reconciles of a NamespaceEndpointGroup while the ACI CNI configuration is invalid. The changes of the configuration
+// only trigger the reconcile of the SegmentationPolicies
+const invalidCniConfigRequeueInterval = 30 * time.Second
+
+//+kubebuilder:rbac:groups=apic.aci.cisco,resources=namespaceendpointgroups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apic.aci.cisco,resources=namespaceendpointgroups/status,verbs=get;update;patch
+
+func (r *NamespaceEndpointGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	defer r.Watchdog.Start(fmt.Sprintf("NamespaceEndpointGroup %s", req.Name))()
+	ctx, span := startSpan(ctx, "NamespaceEndpointGroup.Reconcile")
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *NamespaceEndpointGroupReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	nsEpg := &v1alpha1.NamespaceEndpointGroup{}
+	if err := r.Get(ctx, req.NamespacedName, nsEpg); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	cniConf, err := r.CniConfig.Get()
+	if err != nil {
+		logger.Info(fmt.Sprintf("Invalid ACI CNI configuration, skipping NamespaceEndpointGroup %s: %s", nsEpg.Name, err))
+		return ctrl.Result{RequeueAfter: invalidCniConfigRequeueInterval}, nil
+	}
+
+	policies := &v1alpha1.SegmentationPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		return ctrl.Result{}, err
+	}
+	references := []string{}
+	for i := range policies.Items {
+		if referencesEpg(&policies.Items[i], nsEpg.Spec.Namespace) {
+			references = append(references, fmt.Sprintf("%s/%s", policies.Items[i].Namespace, policies.Items[i].Name))
+		}
+	}
+	sort.Strings(references)
+
+	appName := appProfileName(r.ClusterID, cniConf.PolicyTenant)
+	exists, err := apicWithContext(ctx, r.ApicClient).EpgExists(nsEpg.Spec.Namespace, appName, cniConf.PolicyTenant)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("error occurred while reading the EPG %s: %w", nsEpg.Spec.Namespace, err)
+	}
+	if !exists && len(references) == 0 {
+		logger.Info(fmt.Sprintf("EPG %s deleted, removing its NamespaceEndpointGroup", nsEpg.Spec.Namespace))
+		return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, nsEpg))
+	}
+
+	status := v1alpha1.NamespaceEndpointGroupStatus{Policies: references, State: EpgStateMissing}
+	if exists {
+		contracts, err := apicWithContext(ctx, r.ApicClient).GetContracts(nsEpg.Spec.Namespace, appName, cniConf.PolicyTenant)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("error occurred while reading the contracts of EPG %s: %w", nsEpg.Spec.Namespace, err)
+		}
+		settings, err := apicWithContext(ctx, r.ApicClient).GetEpgSettings(nsEpg.Spec.Namespace, appName, cniConf.PolicyTenant)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("error occurred while reading the settings of EPG %s: %w", nsEpg.Spec.Namespace, err)
+		}
+		bd, vmms, err := apicWithContext(ctx, r.ApicClient).GetEpgDomains(nsEpg.Spec.Namespace, appName, cniConf.PolicyTenant)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("error occurred while reading the domains of EPG %s: %w", nsEpg.Spec.Namespace, err)
+		}
+		status = v1alpha1.NamespaceEndpointGroupStatus{
+			Dn:                fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", cniConf.PolicyTenant, appName, nsEpg.Spec.Namespace),
+			BridgeDomain:      bd,
+			VmmDomain:         strings.Join(vmms, ", "),
+			Master:            strings.Join(contracts["inherited"], ", "),
+			ConsumedContracts: contracts["consumed"],
+			ProvidedContracts: contracts["provided"],
+			IntraEpgIsolation: settings.IntraEpgIsolation,
+			PreferredGroup:    settings.PreferredGroup,
+			FloodOnEncap:      settings.FloodOnEncap,
+			Policies:          references,
+			State:             EpgStateCreated,
+		}
+	}
+	if !equality.Semantic.DeepEqual(nsEpg.Status, status) {
+		nsEpg.Status = status
+		if err := r.Status().Update(ctx, nsEpg); err != nil {
+			return ctrl.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
+		}
+	}
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NamespaceEndpointGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.NamespaceEndpointGroup{}).
+		Watches(&source.Kind{Type: &v1alpha1.SegmentationPolicy{}}, handler.EnqueueRequestsFromMapFunc(segPolNamespaceEpgsMapFunc)).
+		Complete(r)
+}
+
+// Generate NamespaceEndpointGroup requests based on changes in the SegmentationPolicies referencing them
+func segPolNamespaceEpgsMapFunc(object client.Object) []reconcile.Request {
+	segPol := object.(*v1alpha1.SegmentationPolicy)
+	epgs := append([]string{}, segPol.Status.EndpointGroups...)
+	requests := []reconcile.Request{}
+	for _, epg := range append(epgs, utils.Unique(epgs, segPol.Spec.Namespaces)...) {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: epg}})
+	}
+	return requests
+}
+
+// Create the NamespaceEndpointGroups of the EPGs configured on the APIC. Existing ones are left untouched, their status is set by the
+// NamespaceEndpointGroupReconciler
+func ensureNamespaceEndpointGroups(ctx context.Context, c client.Client, epgs []string) error {
+	for _, epg := range epgs {
+		nsEpg := &v1alpha1.NamespaceEndpointGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: epg},
+			Spec:       v1alpha1.NamespaceEndpointGroupSpec{Namespace: epg},
+		}
+		if err := c.Create(ctx, nsEpg); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("error occurred while creating the NamespaceEndpointGroup %s: %w", epg, err)
+		}
+	}
+	return nil
+}
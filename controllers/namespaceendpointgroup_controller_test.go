@@ -0,0 +1,85 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+)
+
+// The EPG of a Namespace is reflected in a NamespaceEndpointGroup while a SegmentationPolicy references it
+
+var _ = Describe("NamespaceEndpointGroup controller", func() {
+	const (
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+	ctx := context.Background()
+
+	Context("When a Segmentation Policy creates the EPG of a Namespace", func() {
+		It("Should report the EPG until it is deleted", func() {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-nsepg"}}
+			segPol := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "nsepgpol",
+					Namespace: "default",
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{ns.Name},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 8443}},
+				},
+			}
+			nsEpgLookupKey := types.NamespacedName{Name: ns.Name}
+			By("Creating the Namespace and the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, ns)).Should(Succeed())
+				Expect(k8sClient.Create(ctx, segPol)).Should(Succeed())
+			})
+			By("Checking the NamespaceEndpointGroup reports the EPG", func() {
+				nsEpg := &v1alpha1.NamespaceEndpointGroup{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, nsEpgLookupKey, nsEpg)
+					return nsEpg.Status.State
+				}, timeout, interval).Should(Equal(EpgStateCreated))
+				appName := fmt.Sprintf(ApplicationProfileNamePrefix, cniConf.PolicyTenant)
+				Expect(nsEpg.Spec.Namespace).Should(Equal(ns.Name))
+				Expect(nsEpg.Status.Dn).Should(Equal(fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", cniConf.PolicyTenant, appName, ns.Name)))
+				Expect(nsEpg.Status.BridgeDomain).Should(Equal(cniConf.PodBridgeDomain))
+				Expect(nsEpg.Status.VmmDomain).Should(Equal(cniConf.KubernetesVmmDomain))
+				Expect(nsEpg.Status.Master).Should(Equal(fmt.Sprintf("%s/%s", cniConf.ApplicationProfileKubeDefault, cniConf.EPGKubeDefault)))
+				Expect(nsEpg.Status.ConsumedContracts).Should(ContainElement(segPol.Name))
+				Expect(nsEpg.Status.ProvidedContracts).Should(ContainElement(segPol.Name))
+				Expect(nsEpg.Status.Policies).Should(Equal([]string{"default/nsepgpol"}))
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol)).Should(Succeed())
+			})
+			By("Checking the NamespaceEndpointGroup is deleted with the EPG", func() {
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, nsEpgLookupKey, &v1alpha1.NamespaceEndpointGroup{})
+					return errors.IsNotFound(err)
+				}, timeout, interval).Should(BeTrue())
+			})
+		})
+	})
+})
@@ -0,0 +1,139 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+const (
+	// Annotation of the SegmentationPolicies whose changes are only planned, not applied to the APIC
+	AnnotationDryRun = "apic.aci.cisco/dry-run"
+	// Condition of the SegmentationPolicies reporting whether the reconciler runs in dry-run mode
+	ConditionDryRun = "DryRun"
+	// Reason of the Event reporting the changes planned in dry-run mode
+	ReasonPlanned = "Planned"
+
+	PlanActionCreate = "create"
+	PlanActionUpdate = "update"
+	PlanActionDelete = "delete"
+)
+
+// Whether the changes of the SegmentationPolicy must only be planned, either for all the policies or for this one
+func (r *SegmentationPolicyReconciler) dryRun(segPol *v1alpha1.SegmentationPolicy) bool {
+	return r.DryRun || segPol.Annotations[AnnotationDryRun] == "true"
+}
+
+// Compute the changes the configuration tree would make on the APIC by comparing its attributes with the objects on the APIC.
+// Only read-only calls are sent to the APIC
+func (r *SegmentationPolicyReconciler) planChanges(ctx context.Context, tenantMo *aci.ManagedObject) ([]v1alpha1.PlannedChange, error) {
+	changes, err := aci.DiffMo(r.apic(ctx), tenantMo)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred while reading the APIC objects of the plan: %w", err)
+	}
+	actions := map[string]string{aci.ChangeCreated: PlanActionCreate, aci.ChangeModified: PlanActionUpdate, aci.ChangeDeleted: PlanActionDelete}
+	plan := []v1alpha1.PlannedChange{}
+	for _, change := range changes {
+		// Updates only list the attributes which change
+		plan = append(plan, v1alpha1.PlannedChange{Action: actions[change.Status], Class: change.Class, Dn: change.Dn, Attributes: change.After})
+	}
+	return plan, nil
+}
+
+// Number of changes of the plan per action
+func planSummary(plan []v1alpha1.PlannedChange) string {
+	counts := map[string]int{}
+	for _, change := range plan {
+		counts[change.Action]++
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to delete", counts[PlanActionCreate], counts[PlanActionUpdate], counts[PlanActionDelete])
+}
+
+// Report in the status the changes the SegmentationPolicy would make on the APIC. Neither the APIC nor the Namespaces are modified
+func (r *SegmentationPolicyReconciler) reportPlan(ctx context.Context, segPol *v1alpha1.SegmentationPolicy, tenantMo *aci.ManagedObject) (ctrl.Result, error) {
+	plan, err := r.planChanges(ctx, tenantMo)
+	if err != nil {
+		r.apicErrorEvent(segPol, err)
+		return ctrl.Result{}, err
+	}
+	log.FromContext(ctx).Info(fmt.Sprintf("Dry-run of Segmentation Policy %s: %s", segPol.Name, planSummary(plan)))
+	if err := r.setPlan(ctx, segPol, plan, "Planned", fmt.Sprintf("Changes not applied to the APIC: %s", planSummary(plan))); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.event(segPol, corev1.EventTypeNormal, ReasonPlanned, fmt.Sprintf("Planned changes on the APIC: %s", planSummary(plan)))
+	return ctrl.Result{}, nil
+}
+
+// Report in the status the cleanup of a SegmentationPolicy deleted in dry-run mode. Neither the APIC objects nor the finalizer are
+// removed: the cleanup is applied once the dry-run mode is disabled for the policy
+func (r *SegmentationPolicyReconciler) deleteDryRun(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPol *v1alpha1.SegmentationPolicy) (ctrl.Result, error) {
+	var tenantMo *aci.ManagedObject
+	var err error
+	switch deletionPolicy(segPol) {
+	case v1alpha1.DeletionPolicyOrphan:
+		tenantMo, err = r.orphanTenantMo(ctx, cniConf, segPol)
+	case v1alpha1.DeletionPolicyRetain:
+		tenantMo, _, _, err = r.retentionTenantMo(ctx, logger, cniConf, segPol)
+	default:
+		tenantMo, _, err = r.deletionTenantMo(ctx, logger, cniConf, segPol)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	plan, err := r.planChanges(ctx, tenantMo)
+	if err != nil {
+		r.apicErrorEvent(segPol, err)
+		return ctrl.Result{}, err
+	}
+	logger.Info(fmt.Sprintf("Dry-run of the deletion of Segmentation Policy %s: %s", segPol.Name, planSummary(plan)))
+	message := fmt.Sprintf("Deletion policy %s not applied to the APIC: %s. The finalizer is kept until the dry-run mode is disabled", deletionPolicy(segPol), planSummary(plan))
+	if err := r.setPlan(ctx, segPol, plan, "DeletionPlanned", message); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.event(segPol, corev1.EventTypeNormal, ReasonPlanned, fmt.Sprintf("Planned cleanup on the APIC: %s", planSummary(plan)))
+	return ctrl.Result{}, nil
+}
+
+// Set the plan, the state and the DryRun condition in the status
+func (r *SegmentationPolicyReconciler) setPlan(ctx context.Context, segPol *v1alpha1.SegmentationPolicy, plan []v1alpha1.PlannedChange, state, message string) error {
+	segPol.Status.Plan = plan
+	segPol.Status.State = state
+	meta.SetStatusCondition(&segPol.Status.Conditions, metav1.Condition{
+		Type:               ConditionDryRun,
+		Status:             metav1.ConditionTrue,
+		Reason:             "DryRun",
+		Message:            message,
+		ObservedGeneration: segPol.Generation,
+	})
+	if err := r.Status().Update(ctx, segPol); err != nil {
+		return fmt.Errorf("error occurred while setting the status: %w", err)
+	}
+	policyStates.set(types.NamespacedName{Namespace: segPol.Namespace, Name: segPol.Name}, segPol.Status.State)
+	return nil
+}
@@ -19,17 +19,20 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -46,18 +49,33 @@ var (
 	finalizersSegPol = "finalizers.segmentationpolicies.apic.aci.cisco/delete"
 )
 
+const (
+	// Condition of the deleted SegmentationPolicies reporting the cleanup of their APIC objects
+	ConditionApicCleanup    = "ApicCleanup"
+	ReasonCleanupInProgress = "InProgress"
+	ReasonCleanupFailed     = "Failed"
+)
+
 // SegmentationPolicyReconciler reconciles a SegmentationPolicy object
 type SegmentationPolicyReconciler struct {
 	client.Client
 	Scheme     *runtime.Scheme
 	ApicClient aci.ApicInterface
-	CniConfig  AciCniConfig
+	CniConfig  *CniConfigStore
+	// Requests to reconcile all the SegmentationPolicies after a change of the ACI CNI configuration
+	CniConfigEvents <-chan event.GenericEvent
+	Watchdog        *ReconcileWatchdog
+	// Events of the changes on the APIC, emitted on the SegmentationPolicies and the affected Namespaces
+	Recorder record.EventRecorder
+	// Only plan the changes of all the SegmentationPolicies, without applying them to the APIC
+	DryRun bool
+	// Identity of the cluster stamped in the names and tags of its APIC objects. Required if several clusters share the policy tenant
+	ClusterID string
 }
 
 type AciCniConfig struct {
-	ApicIp                        string
+	ApicHosts                     []string
 	ApicUsername                  string
-	ApicPrivateKey                string
 	KeyPath                       string
 	PolicyTenant                  string
 	PodBridgeDomain               string
@@ -74,9 +92,12 @@ const (
 //+kubebuilder:rbac:groups=apic.aci.cisco,resources=segmentationpolicies/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=apic.aci.cisco,resources=segmentationpolicies/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;patch
-//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;
 //+kubebuilder:rbac:groups="",resources=pods/exec,verbs=create;
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=apic.aci.cisco,resources=namespaceendpointgroups,verbs=get;list;watch;create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -88,6 +109,16 @@ const (
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
 func (r *SegmentationPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	defer r.Watchdog.Start(fmt.Sprintf("SegmentationPolicy %s", req.NamespacedName))()
+	// The APIC changes are audited with the SegmentationPolicy
+	ctx = aci.WithPolicy(ctx, req.String())
+	ctx, span := startSpan(ctx, "SegmentationPolicy.Reconcile", AttributeSegmentationPolicy.String(req.String()))
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *SegmentationPolicyReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
 	segPolObject := &v1alpha1.SegmentationPolicy{}
@@ -95,17 +126,58 @@ func (r *SegmentationPolicyReconciler) Reconcile(ctx context.Context, req ctrl.R
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("SegmentationPolicy resource not found. Ignoring since object must be deleted")
+			forgetPolicyMetrics(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "Error occurred while fetching the Segmentation Policy resource")
 		return ctrl.Result{}, err
 	}
 
+	// Suspended policies are reconciled again once resumed. The deletion of a suspended policy is not suspended
+	if segPolObject.GetDeletionTimestamp().IsZero() {
+		if segPolObject.Spec.Suspend {
+			return r.suspend(ctx, segPolObject)
+		}
+		r.resume(segPolObject)
+	}
+
+	// The policy is reconciled again once the ACI CNI configuration is valid
+	cniConf, err := r.CniConfig.Get()
+	if err != nil {
+		logger.Info(fmt.Sprintf("Invalid ACI CNI configuration: %s", err))
+		segPolObject.Status.State = "Blocked"
+		meta.SetStatusCondition(&segPolObject.Status.Conditions, metav1.Condition{
+			Type:               ConditionCniConfigValid,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InvalidCniConfig",
+			Message:            err.Error(),
+			ObservedGeneration: segPolObject.Generation,
+		})
+		if err := r.Status().Update(ctx, segPolObject); err != nil {
+			return reconcile.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
+		}
+		policyStates.set(req.NamespacedName, segPolObject.Status.State)
+		return ctrl.Result{}, nil
+	}
+	meta.SetStatusCondition(&segPolObject.Status.Conditions, metav1.Condition{
+		Type:               ConditionCniConfigValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             "CniConfigValid",
+		Message:            fmt.Sprintf("ACI CNI configuration of tenant %s is valid", cniConf.PolicyTenant),
+		ObservedGeneration: segPolObject.Generation,
+	})
+	// The plan is only reported in dry-run mode
+	if !r.dryRun(segPolObject) {
+		meta.RemoveStatusCondition(&segPolObject.Status.Conditions, ConditionDryRun)
+		segPolObject.Status.Plan = nil
+	}
+
 	segPolObject.Status.State = "Creating"
 	err = r.Status().Update(context.Background(), segPolObject)
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
 	}
+	policyStates.set(req.NamespacedName, segPolObject.Status.State)
 
 	// if the event is not related to delete, just check if the finalizers are rightfully set on the resource
 	if segPolObject.GetDeletionTimestamp().IsZero() && !controllerutil.ContainsFinalizer(segPolObject, finalizersSegPol) {
@@ -121,68 +193,147 @@ func (r *SegmentationPolicyReconciler) Reconcile(ctx context.Context, req ctrl.R
 	// hence, it's time to clean up the finalizers
 	if !segPolObject.GetDeletionTimestamp().IsZero() && controllerutil.ContainsFinalizer(segPolObject, finalizersSegPol) {
 		logger.Info("Deletion detected! Proceeding to cleanup the finalizers...")
-		if err := r.deleteSegPolicyFinalizerCallback(ctx, logger, segPolObject); err != nil {
+		if r.dryRun(segPolObject) {
+			return r.deleteDryRun(ctx, logger, cniConf, segPolObject)
+		}
+		finalizerCtx, span := startSpan(ctx, "deleteSegPolicyFinalizerCallback")
+		err := r.deleteSegPolicyFinalizerCallback(finalizerCtx, logger, cniConf, segPolObject)
+		endSpan(span, err)
+		if err != nil {
 			logger.Error(err, "error occurred while dealing with the delete finalizer")
+			r.apicErrorEvent(segPolObject, err)
 			return ctrl.Result{}, err
 		}
+		forgetPolicyMetrics(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
-	// Reconcile K8s SegmentationPolicies' Namespaces and APIC EPGs
-	result, err := r.ReconcileNamespacesEpgs(ctx, logger, segPolObject)
-	if err != nil {
+	// Objects with the names of the policy not managed by the operator are only modified if the policy adopts them
+	if stop, result, err := r.checkPreExistingObjects(ctx, cniConf, segPolObject); stop {
 		return result, err
 	}
 
-	segPolObject.Status.State = "EPGs Created"
-	err = r.Status().Update(context.Background(), segPolObject)
+	// All the APIC objects of the SegmentationPolicy are posted in a single transaction at the tenant level
+	tenantMo := aci.TenantMo(cniConf.PolicyTenant)
+
+	// Reconcile K8s SegmentationPolicies' Namespaces and APIC EPGs
+	phaseCtx, span := startSpan(ctx, "ReconcileNamespacesEpgs")
+	epgs, nsAnnotate, nsRemoveAnnotation, nsSettings, err := r.ReconcileNamespacesEpgs(phaseCtx, logger, cniConf, segPolObject, tenantMo)
+	endSpan(span, err)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
+		r.apicErrorEvent(segPolObject, err)
+		return ctrl.Result{}, err
 	}
 
 	// Create Contract and Subject and associate the filters
+	polName := policyObjectName(r.ClusterID, segPolObject.Name)
 	filtersSegPol := []string{}
 	for _, rule := range segPolObject.Spec.Rules {
-		filterName := fmt.Sprintf("%s_%s%s%s", segPolObject.Name, rule.Eth, rule.IP, strconv.Itoa(rule.Port))
+		filterName := ruleFilterName(r.ClusterID, segPolObject.Name, rule)
 		filtersSegPol = append(filtersSegPol, filterName)
 	}
 
 	// Create contract (and subject) with all the filters listed in the SegmentationPolicy
-	r.ApicClient.CreateContract(r.CniConfig.PolicyTenant, segPolObject.Name, filtersSegPol)
-	logger.Info(fmt.Sprintf("Creating Contract/Subject %s", segPolObject.Name))
+	logger.Info(fmt.Sprintf("Creating Contract/Subject %s", polName))
+	contractMo := aci.ContractMo(polName, filtersSegPol)
+	tenantMo.AddChild(contractMo)
 
 	// Read from the APIC the filters configured on the contract
-	apicFilters, _ := r.ApicClient.GetContractFilters(segPolObject.Name, r.CniConfig.PolicyTenant)
+	apicFilters, err := r.apic(ctx).GetContractFilters(polName, cniConf.PolicyTenant)
+	if err != nil {
+		err = fmt.Errorf("error occurred while reading the filters of contract %s: %w", polName, err)
+		r.apicErrorEvent(segPolObject, err)
+		return ctrl.Result{}, err
+	}
 	logger.Info(fmt.Sprintf("Contract Filters %s", apicFilters))
 
 	// Delete/Update SubjectToFilter associations configured on the APIC but not listed in the SegmentationPolicy
+	subjectMo := contractMo.GetChild("vzSubj", "name", polName)
 	for _, apicFlt := range utils.Unique(filtersSegPol, apicFilters) {
-		r.ApicClient.DeleteFilterFromSubjectContract(segPolObject.Name, r.CniConfig.PolicyTenant, apicFlt)
+		subjectMo.AddChild(aci.SubjectFilterMo(apicFlt).Deleted())
 	}
 
 	// Reconcile K8s SegmentationPolicies' Rules and APIC Filters
-	result, err = r.ReconcileRulesFilters(logger, segPolObject)
+	phaseCtx, span = startSpan(ctx, "ReconcileRulesFilters")
+	result, err := r.ReconcileRulesFilters(phaseCtx, logger, cniConf, segPolObject, tenantMo)
+	endSpan(span, err)
 	if err != nil {
 		return result, err
 	}
+
+	if r.dryRun(segPolObject) {
+		return r.reportPlan(ctx, segPolObject, tenantMo)
+	}
+
+	// Commit the configuration. Either all the objects are created/deleted or none of them
+	logger.Info(fmt.Sprintf("Posting configuration of Segmentation Policy %s to Tenant %s", segPolObject.Name, cniConf.PolicyTenant))
+	if err := r.apic(ctx).PostTenantConfig(tenantMo); err != nil {
+		logger.Error(err, "error occurred while posting the configuration to the APIC")
+		r.apicErrorEvent(segPolObject, fmt.Errorf("unable to post the configuration to the APIC: %w", err))
+		return ctrl.Result{}, err
+	}
+	for _, ns := range nsAnnotate {
+		r.namespaceEvent(ctx, segPolObject, ns, corev1.EventTypeNormal, ReasonEpgCreated, fmt.Sprintf("Created EPG %s", ns))
+	}
+	if len(apicFilters) == 0 {
+		r.event(segPolObject, corev1.EventTypeNormal, ReasonContractCreated, fmt.Sprintf("Created Contract %s with Filters %s", polName, joinNames(filtersSegPol)))
+	} else if added, removed := utils.Unique(apicFilters, filtersSegPol), utils.Unique(filtersSegPol, apicFilters); len(added) > 0 || len(removed) > 0 {
+		r.event(segPolObject, corev1.EventTypeNormal, ReasonContractUpdated,
+			fmt.Sprintf("Updated Contract %s. Filters added: %s. Filters removed: %s", polName, joinNames(added), joinNames(removed)))
+	}
+	r.postedConfigEvents(ctx, segPolObject, tenantMo)
+
+	// K8s Namespaces are only (un)annotated once their EPGs are configured on the APIC
+	for _, ns := range nsAnnotate {
+		logger.Info(fmt.Sprintf("Annotation K8s Namespace %s", ns))
+		if err := r.AnnotateNamespace(ctx, ns, appProfileName(r.ClusterID, cniConf.PolicyTenant), cniConf.PolicyTenant); err != nil {
+			logger.Info(fmt.Sprintf("Error k8s annotation %s", err))
+			r.namespaceEvent(ctx, segPolObject, ns, corev1.EventTypeWarning, ReasonNamespaceAnnotated, fmt.Sprintf("Unable to annotate Namespace %s with EPG %s: %s", ns, ns, err))
+			continue
+		}
+		r.namespaceEvent(ctx, segPolObject, ns, corev1.EventTypeNormal, ReasonNamespaceAnnotated, fmt.Sprintf("Annotated Namespace %s with EPG %s", ns, ns))
+	}
+	for _, ns := range nsRemoveAnnotation {
+		r.removeNamespaceAnnotation(ctx, segPolObject, ns)
+	}
+	for ns, value := range nsSettings {
+		if err := recordEpgSettings(ctx, r.Client, ns, value); err != nil {
+			logger.Error(err, fmt.Sprintf("unable to record the EPG settings of Namespace %s", ns))
+		}
+	}
+	// The policy references the EPGs through their NamespaceEndpointGroups. If they cannot be created the request is retried once the
+	// status records the EPGs configured on the APIC
+	nsEpgErr := ensureNamespaceEndpointGroups(ctx, r.Client, epgs)
+	if nsEpgErr != nil {
+		logger.Error(nsEpgErr, "unable to create the NamespaceEndpointGroups")
+	}
+
+	recordPolicySync(segPolObject, desiredState(segPolObject, cniConf, epgs), tenantMo)
+
+	// The EPGs are only recorded as referenced by the policy once they are configured on the APIC
+	segPolObject.Status.EndpointGroups = epgs
 	segPolObject.Status.State = "Enforced"
 	err = r.Status().Update(context.Background(), segPolObject)
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
 	}
+	policyStates.set(req.NamespacedName, segPolObject.Status.State)
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, nsEpgErr
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SegmentationPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.SegmentationPolicy{}).
+	//TODO: Make the code convergent. Status attributes should only be modified if the APIC is actually modified
+	controller := ctrl.NewControllerManagedBy(mgr).
+		// The dry-run annotation is not part of the spec
+		For(&v1alpha1.SegmentationPolicy{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
 		Watches(&source.Kind{Type: &corev1.Namespace{}},
-			handler.EnqueueRequestsFromMapFunc(r.nameSpaceSegPolicyMapFunc)).
-		//TODO: Make the code convergent. Status attributes should only be modified if the APIC is actually modified
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		Complete(r)
+			handler.EnqueueRequestsFromMapFunc(r.nameSpaceSegPolicyMapFunc), builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, epgSettingsChangedPredicate)))
+	if r.CniConfigEvents != nil {
+		controller = controller.Watches(&source.Channel{Source: r.CniConfigEvents}, &handler.EnqueueRequestForObject{})
+	}
+	return controller.Complete(r)
 }
 
 // Generate SegmentationPolicy request based on changes in the K8s Namespaces
@@ -212,139 +363,365 @@ func (r *SegmentationPolicyReconciler) nameSpaceSegPolicyMapFunc(object client.O
 	return requests
 }
 
-// Remove the APIC objects associated with a SegmentationPolicy
-func (r *SegmentationPolicyReconciler) deleteSegPolicyFinalizerCallback(ctx context.Context, logger logr.Logger, segPolObject *v1alpha1.SegmentationPolicy) error {
+// Clean up the APIC objects associated with a SegmentationPolicy and remove its finalizer. The finalizer is only removed once the
+// cleanup succeeds, so that failed cleanups are retried. The progress is reported by the ApicCleanup condition
+func (r *SegmentationPolicyReconciler) deleteSegPolicyFinalizerCallback(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy) error {
+	segPolObject.Status.State = "Deleting"
+	if err := r.setCleanupCondition(ctx, segPolObject, ReasonCleanupInProgress, fmt.Sprintf("Deletion policy %s. Cleaning up the APIC objects", deletionPolicy(segPolObject))); err != nil {
+		return err
+	}
+	policyStates.set(types.NamespacedName{Namespace: segPolObject.Namespace, Name: segPolObject.Name}, segPolObject.Status.State)
+
+	var err error
+	switch deletionPolicy(segPolObject) {
+	case v1alpha1.DeletionPolicyOrphan:
+		err = r.orphanApicObjects(ctx, logger, cniConf, segPolObject)
+	case v1alpha1.DeletionPolicyRetain:
+		err = r.retainApicObjects(ctx, logger, cniConf, segPolObject)
+	default:
+		err = r.deleteApicObjects(ctx, logger, cniConf, segPolObject)
+	}
+	if err != nil {
+		if statusErr := r.setCleanupCondition(ctx, segPolObject, ReasonCleanupFailed, err.Error()); statusErr != nil {
+			logger.Error(statusErr, "unable to report the failed cleanup")
+		}
+		return err
+	}
 
-	// TODO:  Update() call fails if the segPolObject is "used" (atributes are used to delete obejcts from the APIC) beforehand. Ask in Slack
-	// remove finalizer
+	// The finalizer is removed with a patch, which does not conflict with the status updates made during the cleanup
+	patch := client.MergeFrom(segPolObject.DeepCopy())
 	controllerutil.RemoveFinalizer(segPolObject, finalizersSegPol)
-	if err := r.Update(ctx, segPolObject); err != nil {
+	if err := r.Patch(ctx, segPolObject, patch); err != nil {
 		return fmt.Errorf("error occurred while removing the finalizer: %w", err)
 	}
+	logger.Info(fmt.Sprintf("cleaned up the '%s' finalizer successfully", finalizersSegPol))
+	return nil
+}
+
+// Remove the APIC objects associated with a SegmentationPolicy. EPGs used by other SegmentationPolicies are only updated
+func (r *SegmentationPolicyReconciler) deleteApicObjects(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy) error {
+	appName := appProfileName(r.ClusterID, cniConf.PolicyTenant)
+	tenantMo, nsRemoveAnnotation, err := r.deletionTenantMo(ctx, logger, cniConf, segPolObject)
+	if err != nil {
+		return err
+	}
+	if err := r.apic(ctx).PostTenantConfig(tenantMo); err != nil {
+		return fmt.Errorf("error occurred while deleting the APIC objects: %w", err)
+	}
+	r.postedConfigEvents(ctx, segPolObject, tenantMo)
+	for _, ns := range nsRemoveAnnotation {
+		r.removeNamespaceAnnotation(ctx, segPolObject, ns)
+	}
 
-	// Delete all the filters defined in the SegmenationPolicy
+	// If there are not more EPGs in the Application Profile, delete the Application profile
+	logger.Info(fmt.Sprintf("Checking EPGs in Application Profile %s", appName))
+	empty, err := r.apic(ctx).EmptyApplicationProfile(appName, cniConf.PolicyTenant)
+	if err != nil {
+		return fmt.Errorf("error occurred while reading the EPGs of the Application Profile %s: %w", appName, err)
+	}
+	if empty {
+		if err := r.apic(ctx).DeleteApplicationProfile(appName, cniConf.PolicyTenant); err != nil {
+			return fmt.Errorf("error occurred while deleting the Application Profile %s: %w", appName, err)
+		}
+	}
+	return nil
+}
+
+// Tenant MO deleting the APIC objects of a SegmentationPolicy. It also returns the Namespaces whose EPG is deleted
+func (r *SegmentationPolicyReconciler) deletionTenantMo(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy) (*aci.ManagedObject, []string, error) {
+	appName := appProfileName(r.ClusterID, cniConf.PolicyTenant)
+	polName := policyObjectName(r.ClusterID, segPolObject.Name)
+	tenantMo := aci.TenantMo(cniConf.PolicyTenant)
+	appMo := aci.ApplicationProfileRefMo(appName)
+
+	// Delete all the filters defined in the SegmenationPolicy. Objects not managed by the operator are left untouched
 	for _, rule := range segPolObject.Spec.Rules {
-		filterName := fmt.Sprintf("%s_%s%s%s", segPolObject.Name, rule.Eth, rule.IP, strconv.Itoa(rule.Port))
-		// Delete the Filter objects
-		if err := r.ApicClient.DeleteFilter(r.CniConfig.PolicyTenant, filterName); err != nil {
-			return fmt.Errorf("error occurred while deleting filter: %w", err)
+		filterName := ruleFilterName(r.ClusterID, segPolObject.Name, rule)
+		if !utils.Contains(segPolObject.Status.PreExisting, fmt.Sprintf("uni/tn-%s/flt-%s", cniConf.PolicyTenant, filterName)) {
+			tenantMo.AddChild(aci.FilterRefMo(filterName).Deleted())
 		}
 	}
 	// Delete the contract and subject
-	if err := r.ApicClient.DeleteContract(r.CniConfig.PolicyTenant, segPolObject.Name); err != nil {
-		return fmt.Errorf("error occurred while deleting contract: %w", err)
-	}
-
-	// Check the EPGs associated with the SegmentationPolicy
-	for _, nsPol := range segPolObject.Spec.Namespaces {
-		logger.Info(fmt.Sprintf("EPG must be updated %s", nsPol))
-		// Read the Annotation created on the EPG to check with SegmentationPolicies 'mananage' the EPG
-		annotations, _ := r.ApicClient.GetAnnotationsEpg(nsPol, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant)
-		logger.Info(fmt.Sprintf("Annotations configured on EPG %s : %s", nsPol, annotations))
-		// If the EPG only has one annotation (and the annotation that corresponds to the SegmenationPolicy), then delete the EPG
-		if len(annotations) == 1 && annotations[0] == segPolObject.Name {
-			logger.Info(fmt.Sprintf("Deleting EPG  %s", nsPol))
-			r.ApicClient.DeleteEndpointGroup(nsPol, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant)
-			r.RemoveAnnotationNamesapce(ctx, nsPol)
-			// If the EPG has more annotations, then remove the annotation that corresponds to the SegmentationPolicy, and stop consuming/providind the SegmentationPolicy's contract
-		} else if len(annotations) > 1 {
-			logger.Info(fmt.Sprintf("Removing annotation %s from EPG %s", segPolObject.Name, nsPol))
-			r.ApicClient.RemoveTagAnnotation(nsPol, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-			r.ApicClient.DeleteContractConsumer(nsPol, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-			r.ApicClient.DeleteContractProvider(nsPol, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
+	if !utils.Contains(segPolObject.Status.PreExisting, fmt.Sprintf("uni/tn-%s/brc-%s", cniConf.PolicyTenant, polName)) {
+		tenantMo.AddChild(aci.ContractRefMo(polName).Deleted())
+	}
+
+	// Detach the EPGs of the SegmentationPolicy. EPGs referenced by other SegmentationPolicies are only updated
+	epgs, err := r.attachedEpgs(ctx, cniConf, segPolObject)
+	if err != nil {
+		return nil, nil, err
+	}
+	nsRemoveAnnotation := []string{}
+	for _, epg := range epgs {
+		deleted, err := r.detachEpg(ctx, logger, cniConf, segPolObject, appMo, epg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if deleted {
+			nsRemoveAnnotation = append(nsRemoveAnnotation, epg)
 		}
 	}
 
-	// If there are not more EPGs in the Application Profile, delete the Application profile
-	logger.Info(fmt.Sprintf("Checking EPGs in Application Profile %s", fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant)))
-	if empty, _ := r.ApicClient.EmptyApplicationProfile(fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant); empty {
-		r.ApicClient.DeleteApplicationProfile(fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant)
+	if len(appMo.Children) > 0 {
+		tenantMo.AddChild(appMo)
 	}
-	logger.Info(fmt.Sprintf("cleaned up the '%s' finalizer successfully", finalizersSegPol))
+	return tenantMo, nsRemoveAnnotation, nil
+}
+
+// Deletion policy of the SegmentationPolicy. Policies created before the field existed are deleted
+func deletionPolicy(segPol *v1alpha1.SegmentationPolicy) v1alpha1.DeletionPolicy {
+	if segPol.Spec.DeletionPolicy == "" {
+		return v1alpha1.DeletionPolicyDelete
+	}
+	return segPol.Spec.DeletionPolicy
+}
+
+// Report the progress of the cleanup of the APIC objects of a deleted SegmentationPolicy
+func (r *SegmentationPolicyReconciler) setCleanupCondition(ctx context.Context, segPol *v1alpha1.SegmentationPolicy, reason, message string) error {
+	meta.SetStatusCondition(&segPol.Status.Conditions, metav1.Condition{
+		Type:               ConditionApicCleanup,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: segPol.Generation,
+	})
+	if err := r.Status().Update(ctx, segPol); err != nil {
+		return fmt.Errorf("error occurred while setting the status: %w", err)
+	}
+	return nil
+}
+
+// Keep the APIC objects of a deleted SegmentationPolicy, removing its tags and the annotation of the operator. EPGs still referenced by
+// other SegmentationPolicies keep the annotation. The EPGs and the annotation of the Namespaces are kept
+func (r *SegmentationPolicyReconciler) retainApicObjects(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy) error {
+	polName := policyObjectName(r.ClusterID, segPolObject.Name)
+	tenantMo, filters, epgs, err := r.retentionTenantMo(ctx, logger, cniConf, segPolObject)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Deletion policy Retain. Removing the annotations of Segmentation Policy %s from the APIC objects", segPolObject.Name))
+	if err := r.apic(ctx).PostTenantConfig(tenantMo); err != nil {
+		return fmt.Errorf("error occurred while removing the annotations from the APIC objects: %w", err)
+	}
+	r.event(segPolObject, corev1.EventTypeNormal, ReasonApicObjectsRetained,
+		fmt.Sprintf("Deletion policy Retain. Kept Contract %s, Filters %s and EPGs %s without the annotations of the operator", polName, joinNames(filters), joinNames(epgs)))
 	return nil
 }
 
-// Reconcile the EPGs on the APIC based on the SegmentationPolicy definition
-func (r *SegmentationPolicyReconciler) ReconcileNamespacesEpgs(ctx context.Context, logger logr.Logger, segPolObject *v1alpha1.SegmentationPolicy) (ctrl.Result, error) {
+// Tenant MO removing the tags and the annotation of the operator from the APIC objects of a SegmentationPolicy. It also returns the
+// Filters and EPGs kept
+func (r *SegmentationPolicyReconciler) retentionTenantMo(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy) (*aci.ManagedObject, []string, []string, error) {
+	appName := appProfileName(r.ClusterID, cniConf.PolicyTenant)
+	polName := policyObjectName(r.ClusterID, segPolObject.Name)
+	tenantMo := aci.TenantMo(cniConf.PolicyTenant)
+	appMo := aci.ApplicationProfileRefMo(appName)
+
+	filters := []string{}
+	for _, rule := range segPolObject.Spec.Rules {
+		filterName := ruleFilterName(r.ClusterID, segPolObject.Name, rule)
+		if utils.Contains(segPolObject.Status.PreExisting, fmt.Sprintf("uni/tn-%s/flt-%s", cniConf.PolicyTenant, filterName)) {
+			continue
+		}
+		filters = append(filters, filterName)
+		tenantMo.AddChild(aci.FilterRefMo(filterName).Unmanaged().AddChild(aci.TagAnnotationMo(polName, polName).Deleted()))
+	}
+	if !utils.Contains(segPolObject.Status.PreExisting, fmt.Sprintf("uni/tn-%s/brc-%s", cniConf.PolicyTenant, polName)) {
+		tenantMo.AddChild(aci.ContractRefMo(polName).Unmanaged())
+	}
+
+	epgs, err := r.attachedEpgs(ctx, cniConf, segPolObject)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, epg := range epgs {
+		logger.Info(fmt.Sprintf("Removing annotation %s from EPG %s", polName, epg))
+		epgMo := aci.EndpointGroupRefMo(epg).AddChild(aci.TagAnnotationMo(polName, polName).Deleted())
+		// EPGs referenced by other SegmentationPolicies are still managed by the operator
+		references, err := r.epgReferences(ctx, epg, segPolObject)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(references) == 0 {
+			epgMo.Unmanaged()
+		}
+		appMo.AddChild(epgMo)
+	}
+	if len(appMo.Children) > 0 {
+		tenantMo.AddChild(appMo)
+	}
+	return tenantMo, filters, epgs, nil
+}
+
+// Keep the APIC objects of a deleted SegmentationPolicy untouched, except for the value of its tags which marks them as orphaned so
+// that the garbage collector leaves them alone
+func (r *SegmentationPolicyReconciler) orphanApicObjects(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy) error {
+	logger.Info(fmt.Sprintf("Deletion policy Orphan. Marking the APIC objects of Segmentation Policy %s as orphaned", segPolObject.Name))
+	tenantMo, err := r.orphanTenantMo(ctx, cniConf, segPolObject)
+	if err != nil {
+		return err
+	}
+	if err := r.apic(ctx).PostTenantConfig(tenantMo); err != nil {
+		return fmt.Errorf("error occurred while marking the APIC objects as orphaned: %w", err)
+	}
+	r.event(segPolObject, corev1.EventTypeNormal, ReasonApicObjectsOrphaned, "Deletion policy Orphan. The APIC objects were left untouched and their tags marked as orphaned")
+	return nil
+}
+
+// Tenant MO setting the value of the tags of the SegmentationPolicy to orphaned on its Filters, Contract and EPGs
+func (r *SegmentationPolicyReconciler) orphanTenantMo(ctx context.Context, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy) (*aci.ManagedObject, error) {
+	polName := policyObjectName(r.ClusterID, segPolObject.Name)
+	tenantMo := aci.TenantMo(cniConf.PolicyTenant)
+	appMo := aci.ApplicationProfileRefMo(appProfileName(r.ClusterID, cniConf.PolicyTenant))
+
+	for _, rule := range segPolObject.Spec.Rules {
+		filterName := ruleFilterName(r.ClusterID, segPolObject.Name, rule)
+		if !utils.Contains(segPolObject.Status.PreExisting, fmt.Sprintf("uni/tn-%s/flt-%s", cniConf.PolicyTenant, filterName)) {
+			tenantMo.AddChild(aci.FilterRefMo(filterName).AddChild(aci.TagAnnotationMo(polName, OrphanedTagValue)))
+		}
+	}
+	if !utils.Contains(segPolObject.Status.PreExisting, fmt.Sprintf("uni/tn-%s/brc-%s", cniConf.PolicyTenant, polName)) {
+		tenantMo.AddChild(aci.ContractRefMo(polName).AddChild(aci.TagAnnotationMo(polName, OrphanedTagValue)))
+	}
+	epgs, err := r.attachedEpgs(ctx, cniConf, segPolObject)
+	if err != nil {
+		return nil, err
+	}
+	for _, epg := range epgs {
+		appMo.AddChild(aci.EndpointGroupRefMo(epg).AddChild(aci.TagAnnotationMo(polName, OrphanedTagValue)))
+	}
+	if len(appMo.Children) > 0 {
+		tenantMo.AddChild(appMo)
+	}
+	return tenantMo, nil
+}
+
+// Add to the tenant MO the EPGs required by the SegmentationPolicy definition. It returns the EPGs attached to the policy, the Namespaces whose annotation must be set/removed and the EPG settings to record on the Namespaces once the configuration is posted to the APIC
+func (r *SegmentationPolicyReconciler) ReconcileNamespacesEpgs(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy, tenantMo *aci.ManagedObject) ([]string, []string, []string, map[string]string, error) {
 
 	// Read the Namespaces configured on K8s
 	nsClusterConf := &corev1.NamespaceList{}
 	r.List(ctx, nsClusterConf)
 	nsClusterNames := []string{}
-	for _, ns := range nsClusterConf.Items {
+	nsClusterObjects := map[string]*corev1.Namespace{}
+	for i, ns := range nsClusterConf.Items {
 		nsClusterNames = append(nsClusterNames, ns.Name)
+		nsClusterObjects[ns.Name] = &nsClusterConf.Items[i]
 	}
 
 	// Set the status
 	segPolObject.Status.Namespaces = strings.Join(utils.Intersect(nsClusterNames, segPolObject.Spec.Namespaces), ", ")
 	err := r.Status().Update(context.Background(), segPolObject)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("error occurred while setting the status: %w", err)
 	}
 
+	appName := appProfileName(r.ClusterID, cniConf.PolicyTenant)
+	polName := policyObjectName(r.ClusterID, segPolObject.Name)
+	epgs := utils.Intersect(nsClusterNames, segPolObject.Spec.Namespaces)
+	nsAnnotate, nsRemoveAnnotation := []string{}, []string{}
+	nsSettings := map[string]string{}
+
 	// Always create/overwrite the same Application Profile
-	logger.Info(fmt.Sprintf("Creating Application Profile %s", segPolObject.Name))
-	r.ApicClient.CreateApplicationProfile(fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), "", r.CniConfig.PolicyTenant)
+	logger.Info(fmt.Sprintf("Creating Application Profile %s", appName))
+	appMo := aci.ApplicationProfileMo(appName, "")
+	tenantMo.AddChild(appMo)
 	// Create EPGs for those namespaces listed in the SegmentationPolicy and configured on K8s
-	for _, ns := range utils.Intersect(nsClusterNames, segPolObject.Spec.Namespaces) {
-		if exists, _ := r.ApicClient.EpgExists(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant); exists {
+	for _, ns := range epgs {
+		var epgMo *aci.ManagedObject
+		exists, err := r.apic(ctx).EpgExists(ns, appName, cniConf.PolicyTenant)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("error occurred while reading the EPG %s: %w", ns, err)
+		}
+		if exists {
 			// If the EPG already exist, just add a new annotation. (An EPG/NS can be included in multiple policies)
-			logger.Info(fmt.Sprintf("Adding annotation to EPG  %s", ns))
-			r.ApicClient.AddTagAnnotationToEpg(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name, segPolObject.Name)
-			// TODO: Unit Test error if Contracts are consumed/provided after the 'if' statement
-			// Always consume/provide contracts
-			logger.Info(fmt.Sprintf("Consume & Provide Segmentation Policy contract for EPG %s", ns))
-			r.ApicClient.ConsumeContract(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-			r.ApicClient.ProvideContract(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
+			epgMo = aci.EndpointGroupRefMo(ns)
 		} else {
 			// If not, create the EPG and add annotation
 			logger.Info(fmt.Sprintf("Creating EPG for Namespace %s", ns))
-			r.ApicClient.CreateEndpointGroup(ns, "", fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, r.CniConfig.PodBridgeDomain, r.CniConfig.KubernetesVmmDomain)
-			// TODO: Unit Test error if Contracts are consumed/provided after the 'if' statement
-			// Always consume/provide contracts
-			logger.Info(fmt.Sprintf("Consume & Provide Segmentation Policy contract for EPG %s", ns))
-			r.ApicClient.ConsumeContract(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-			r.ApicClient.ProvideContract(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-			logger.Info(fmt.Sprintf("Adding annotation to EPG  %s", ns))
-			r.ApicClient.AddTagAnnotationToEpg(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name, segPolObject.Name)
-			logger.Info(fmt.Sprintf("Inheriting Contracts from ap-%s/epg-%s", r.CniConfig.ApplicationProfileKubeDefault, r.CniConfig.EPGKubeDefault))
-			r.ApicClient.InheritContractFromMaster(ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, r.CniConfig.ApplicationProfileKubeDefault, r.CniConfig.EPGKubeDefault)
-			logger.Info(fmt.Sprintf("Annotation K8s Namespace"))
-			err := r.AnnotateNamespace(ctx, ns, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant)
-			if err != nil {
-				logger.Info(fmt.Sprintf("Error k8s annotation %s", err))
-			}
+			epgMo = aci.EndpointGroupMo(ns, "", cniConf.PodBridgeDomain, cniConf.KubernetesVmmDomain)
+			nsAnnotate = append(nsAnnotate, ns)
+		}
+		logger.Info(fmt.Sprintf("Adding annotation to EPG  %s", ns))
+		epgMo.AddChild(aci.TagAnnotationMo(polName, polName))
+		// Only consume/provide the contracts and inherit from the master EPG if the EPG does not do it already
+		if err := r.reconcileEpgContracts(ctx, logger, cniConf, epgMo, ns, polName); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		// Settings requested by the annotations of the Namespace
+		if err := r.reconcileEpgSettings(ctx, logger, cniConf, epgMo, nsClusterObjects[ns], !exists); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if value := managedEpgSettingsValue(namespaceEpgSettings(nsClusterObjects[ns])); value != nsClusterObjects[ns].GetAnnotations()[AnnotationManagedEpgSettings] {
+			nsSettings[ns] = value
 		}
+		appMo.AddChild(epgMo)
 	}
 
-	// Get EPGs configured on the APIC with the SegmentPolicy annotation
-	epgApic, _ := r.ApicClient.GetEpgWithAnnotation(fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-	logger.Info(fmt.Sprintf("List of EPGs under Policy %s :  %s", segPolObject.Name, epgApic))
-	// Delete/Update those EPGs configured on the APIC but not listed in the SegmentationPolicy
-	for _, epg := range utils.Unique(utils.Intersect(nsClusterNames, segPolObject.Spec.Namespaces), epgApic) {
+	// Get the EPGs attached to the SegmentationPolicy
+	epgAttached, err := r.attachedEpgs(ctx, cniConf, segPolObject)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	logger.Info(fmt.Sprintf("List of EPGs under Policy %s :  %s", segPolObject.Name, epgAttached))
+	// Detach those EPGs attached to the policy but not listed in the SegmentationPolicy. EPGs referenced by other policies are only updated
+	for _, epg := range utils.Unique(epgs, epgAttached) {
 		logger.Info(fmt.Sprintf("EPG must be updated %s", epg))
-		annotations, _ := r.ApicClient.GetAnnotationsEpg(epg, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant)
-		logger.Info(fmt.Sprintf("Annotations configured on EPG %s : %s", epg, annotations))
-		// If the EPG only has one annotation (and the annotation that corresponds to the SegmenationPolicy), then delete the EPG
-		if len(annotations) == 1 && annotations[0] == segPolObject.Name {
-			logger.Info(fmt.Sprintf("Deleting EPG  %s", epg))
-			r.ApicClient.DeleteEndpointGroup(epg, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant)
-			r.RemoveAnnotationNamesapce(ctx, epg)
-			// If the EPG has more annotations, then remove the annotation that corresponds to the SegmentationPolicy, and stop consuming/providind the SegmentationPolicy's contract
-		} else if len(annotations) > 1 {
-			logger.Info(fmt.Sprintf("Removing annotation %s from EPG %s", segPolObject.Name, epg))
-			r.ApicClient.RemoveTagAnnotation(epg, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-			r.ApicClient.DeleteContractConsumer(epg, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
-			r.ApicClient.DeleteContractProvider(epg, fmt.Sprintf(ApplicationProfileNamePrefix, r.CniConfig.PolicyTenant), r.CniConfig.PolicyTenant, segPolObject.Name)
+		deleted, err := r.detachEpg(ctx, logger, cniConf, segPolObject, appMo, epg)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if deleted {
+			nsRemoveAnnotation = append(nsRemoveAnnotation, epg)
 		}
 	}
-	return ctrl.Result{}, nil
+	return epgs, nsAnnotate, nsRemoveAnnotation, nsSettings, nil
 }
 
-// Reconcile the filters on the APIC based on the rules defined in the SegmentationPolicy
-func (r *SegmentationPolicyReconciler) ReconcileRulesFilters(logger logr.Logger, segPolObject *v1alpha1.SegmentationPolicy) (ctrl.Result, error) {
+// Consume & provide the SegmentationPolicy contract and inherit the contracts from the default EPG. Only the relations missing on the APIC are added to the EPG MO
+func (r *SegmentationPolicyReconciler) reconcileEpgContracts(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, epgMo *aci.ManagedObject, epg, conName string) error {
+	contracts, err := r.apic(ctx).GetContracts(epg, appProfileName(r.ClusterID, cniConf.PolicyTenant), cniConf.PolicyTenant)
+	if err != nil {
+		return fmt.Errorf("error occurred while reading the contracts of EPG %s: %w", epg, err)
+	}
+	logger.Info(fmt.Sprintf("Contracts configured on EPG %s : %s", epg, contracts))
+	if !utils.Contains(contracts["consumed"], conName) {
+		logger.Info(fmt.Sprintf("Consume Segmentation Policy contract %s for EPG %s", conName, epg))
+		epgMo.AddChild(aci.ContractConsumerMo(conName))
+	}
+	if !utils.Contains(contracts["provided"], conName) {
+		logger.Info(fmt.Sprintf("Provide Segmentation Policy contract %s for EPG %s", conName, epg))
+		epgMo.AddChild(aci.ContractProviderMo(conName))
+	}
+	if !utils.Contains(contracts["inherited"], fmt.Sprintf("%s/%s", cniConf.ApplicationProfileKubeDefault, cniConf.EPGKubeDefault)) {
+		logger.Info(fmt.Sprintf("Inheriting Contracts from ap-%s/epg-%s", cniConf.ApplicationProfileKubeDefault, cniConf.EPGKubeDefault))
+		epgMo.AddChild(aci.ContractMasterMo(cniConf.PolicyTenant, cniConf.ApplicationProfileKubeDefault, cniConf.EPGKubeDefault))
+	}
+	return nil
+}
+
+// Stop consuming & providing the SegmentationPolicy contract. Only the relations configured on the APIC are deleted
+func (r *SegmentationPolicyReconciler) removeEpgContracts(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, epgMo *aci.ManagedObject, epg, conName string) error {
+	contracts, err := r.apic(ctx).GetContracts(epg, appProfileName(r.ClusterID, cniConf.PolicyTenant), cniConf.PolicyTenant)
+	if err != nil {
+		return fmt.Errorf("error occurred while reading the contracts of EPG %s: %w", epg, err)
+	}
+	if utils.Contains(contracts["consumed"], conName) {
+		logger.Info(fmt.Sprintf("EPG %s no longer consumes contract %s", epg, conName))
+		epgMo.AddChild(aci.ContractConsumerMo(conName).Deleted())
+	}
+	if utils.Contains(contracts["provided"], conName) {
+		logger.Info(fmt.Sprintf("EPG %s no longer provides contract %s", epg, conName))
+		epgMo.AddChild(aci.ContractProviderMo(conName).Deleted())
+	}
+	return nil
+}
+
+// Add to the tenant MO the filters defined by the rules of the SegmentationPolicy
+func (r *SegmentationPolicyReconciler) ReconcileRulesFilters(ctx context.Context, logger logr.Logger, cniConf AciCniConfig, segPolObject *v1alpha1.SegmentationPolicy, tenantMo *aci.ManagedObject) (ctrl.Result, error) {
 	//Create Filters and filter entries based on the policy rules
 	filtersSegPol := []string{}
+	polName := policyObjectName(r.ClusterID, segPolObject.Name)
 
 	// Set the status
 	segPolObject.Status.Rules = flattenRules(segPolObject.Spec.Rules)
@@ -355,24 +732,23 @@ func (r *SegmentationPolicyReconciler) ReconcileRulesFilters(logger logr.Logger,
 
 	// Create Filters for those rules listed in the SegmentationPolicy
 	for _, rule := range segPolObject.Spec.Rules {
-		filterName := fmt.Sprintf("%s_%s%s%s", segPolObject.Name, rule.Eth, rule.IP, strconv.Itoa(rule.Port))
+		filterName := ruleFilterName(r.ClusterID, segPolObject.Name, rule)
 		logger.Info(fmt.Sprintf("Checking filter %s ", filterName))
 		filtersSegPol = append(filtersSegPol, filterName)
-		// Only create a filter if it does not exist already
-		if exists, _ := r.ApicClient.FilterExists(filterName, r.CniConfig.PolicyTenant); !exists {
-			logger.Info(fmt.Sprintf("Creating Filter %s", filterName))
-			r.ApicClient.CreateFilterAndFilterEntry(r.CniConfig.PolicyTenant, filterName, rule.Eth, rule.IP, rule.Port)
-			// Annotation is required to keep track of the filters SegmentationPolicy Object created on the APIC
-			logger.Info(fmt.Sprintf("Tag Filter %s with annotation %s", filterName, segPolObject.Name))
-			r.ApicClient.AddTagAnnotationToFilter(filterName, r.CniConfig.PolicyTenant, segPolObject.Name, segPolObject.Name)
-		}
+		// Annotation is required to keep track of the filters SegmentationPolicy Object created on the APIC
+		tenantMo.AddChild(aci.FilterMo(filterName, rule.Eth, rule.IP, rule.Port).AddChild(aci.TagAnnotationMo(polName, polName)))
 	}
 	//Delete filters
-	filtersApic, _ := r.ApicClient.GetFilterWithAnnotation(r.CniConfig.PolicyTenant, segPolObject.Name)
+	filtersApic, err := r.apic(ctx).GetFilterWithAnnotation(cniConf.PolicyTenant, polName)
+	if err != nil {
+		err = fmt.Errorf("error occurred while reading the filters of Policy %s: %w", segPolObject.Name, err)
+		r.apicErrorEvent(segPolObject, err)
+		return ctrl.Result{}, err
+	}
 	logger.Info(fmt.Sprintf("List of filters under Policy %s :  %s", segPolObject.Name, filtersApic))
 	for _, fltApic := range utils.Unique(filtersSegPol, filtersApic) {
 		logger.Info(fmt.Sprintf("Deleting Filter %s", fltApic))
-		r.ApicClient.DeleteFilter(r.CniConfig.PolicyTenant, fltApic)
+		tenantMo.AddChild(aci.FilterRefMo(fltApic).Deleted())
 	}
 	return ctrl.Result{}, nil
 }
@@ -392,15 +768,30 @@ func (r *SegmentationPolicyReconciler) AnnotateNamespace(ctx context.Context, ns
 	return nil
 }
 
+// Remove the EPG annotation of the Namespace and emit the Events of the change
+func (r *SegmentationPolicyReconciler) removeNamespaceAnnotation(ctx context.Context, segPol *v1alpha1.SegmentationPolicy, nsName string) {
+	if err := r.RemoveAnnotationNamesapce(ctx, nsName); err != nil {
+		r.namespaceEvent(ctx, segPol, nsName, corev1.EventTypeWarning, ReasonNamespaceAnnotationRemoved, fmt.Sprintf("Unable to remove the EPG annotation of Namespace %s: %s", nsName, err))
+		return
+	}
+	r.namespaceEvent(ctx, segPol, nsName, corev1.EventTypeNormal, ReasonNamespaceAnnotationRemoved, fmt.Sprintf("Removed the EPG annotation of Namespace %s", nsName))
+}
+
 func (r *SegmentationPolicyReconciler) RemoveAnnotationNamesapce(ctx context.Context, nsName string) error {
+	return removeEpgAnnotation(ctx, r.Client, nsName)
+}
 
-	patch := []byte(`{"metadata":{"annotations":{"opflex.cisco.com/endpoint-group": ""}}}`)
+// Remove the EPG annotation of the Namespace, so that its Pods are placed in the default EPG again. The EPG settings recorded for the
+// deleted EPG are removed as well
+func removeEpgAnnotation(ctx context.Context, c client.Client, nsName string) error {
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{"opflex.cisco.com/endpoint-group": "", "%s": null}}}`, AnnotationManagedEpgSettings))
 	ns := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: nsName,
 		},
 	}
-	if err := r.Client.Patch(ctx, ns, client.RawPatch(types.MergePatchType, patch)); err != nil {
+	if err := c.Patch(ctx, ns, client.RawPatch(types.MergePatchType, patch)); err != nil {
 		return err
 	}
 	return nil
@@ -25,8 +25,11 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // Segmentation Policy DOES NOT manage/own K8s Namespaces.
@@ -202,6 +205,30 @@ var _ = Describe("Segmentation Policy controller", func() {
 					Expect(epg.Master).Should(Equal([]string{fmt.Sprintf("%s/%s", cniConf.ApplicationProfileKubeDefault, cniConf.EPGKubeDefault)}))
 				}
 			})
+			By("Checking the Events emitted on the Segmentation Policy", func() {
+				Eventually(func() []string {
+					events := &corev1.EventList{}
+					if err := k8sClient.List(ctx, events, client.InNamespace(SegmentationPolicyNamespace)); err != nil {
+						return nil
+					}
+					reasons := []string{}
+					for _, event := range events.Items {
+						if event.InvolvedObject.Kind == "SegmentationPolicy" && event.InvolvedObject.Name == segPol1.Name {
+							reasons = append(reasons, event.Reason)
+						}
+					}
+					return reasons
+				}, timeout, interval).Should(ContainElements(ReasonContractCreated, ReasonEpgCreated, ReasonNamespaceAnnotated))
+			})
+			By("Checking the spans of the reconcile and the APIC calls", func() {
+				Eventually(func() []string {
+					names := []string{}
+					for _, span := range spanExporter.GetSpans() {
+						names = append(names, span.Name)
+					}
+					return names
+				}, timeout, interval).Should(ContainElements("SegmentationPolicy.Reconcile", "ReconcileNamespacesEpgs", "ReconcileRulesFilters", "aci.PostTenantConfig"))
+			})
 		})
 	})
 
@@ -532,4 +559,565 @@ var _ = Describe("Segmentation Policy controller", func() {
 			})
 		})
 	})
+
+	// SegmentationPolicy #3 is only planned until the dry-run annotation is removed
+	Context("When creating a Segmentation Policy in dry-run mode", func() {
+		It("Should report the planned changes without modifying the APIC", func() {
+			segPol3 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "segpol3",
+					Namespace:   SegmentationPolicyNamespace,
+					Annotations: map[string]string{AnnotationDryRun: "true"},
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{"ns-a"},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 443}},
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol3.Name, Namespace: SegmentationPolicyNamespace}
+			filterName := fmt.Sprintf("%s_%s%s%s", segPol3.Name, "ip", "tcp", "443")
+			By("Creating a Segmentation Policy with the dry-run annotation", func() {
+				Expect(k8sClient.Create(ctx, segPol3)).Should(Succeed())
+			})
+			By("Checking the plan in the status", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Planned"))
+				Expect(meta.IsStatusConditionTrue(createdSegPol.Status.Conditions, ConditionDryRun)).Should(BeTrue())
+				Expect(createdSegPol.Status.Plan).Should(ContainElement(v1alpha1.PlannedChange{
+					Action:     PlanActionCreate,
+					Class:      "vzFilter",
+					Dn:         fmt.Sprintf("uni/tn-%s/flt-%s", cniConf.PolicyTenant, filterName),
+					Attributes: map[string]string{"name": filterName, "annotation": "orchestrator:kubernetes"},
+				}))
+			})
+			By("Checking the APIC was not modified", func() {
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeFalse())
+				exists, _ = apicClient.EpgExists("ns-a", fmt.Sprintf(ApplicationProfileNamePrefix, cniConf.PolicyTenant), cniConf.PolicyTenant)
+				Expect(exists).Should(BeFalse())
+			})
+			By("Removing the dry-run annotation", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Expect(k8sClient.Get(ctx, segPolLookupKey, createdSegPol)).Should(Succeed())
+				delete(createdSegPol.Annotations, AnnotationDryRun)
+				Expect(k8sClient.Update(ctx, createdSegPol)).Should(Succeed())
+			})
+			By("Checking the plan is applied", func() {
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeTrue())
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+				Expect(createdSegPol.Status.Plan).Should(BeEmpty())
+				Expect(meta.FindStatusCondition(createdSegPol.Status.Conditions, ConditionDryRun)).Should(BeNil())
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol3)).Should(Succeed())
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeFalse())
+			})
+		})
+	})
+
+	// SegmentationPolicy #4 does not modify the APIC until it is resumed
+	Context("When creating a suspended Segmentation Policy", func() {
+		It("Should apply the changes to the APIC once resumed", func() {
+			segPol4 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol4",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{"ns-b"},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "udp", Port: 53}},
+					Suspend:    true,
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol4.Name, Namespace: SegmentationPolicyNamespace}
+			filterName := fmt.Sprintf("%s_%s%s%s", segPol4.Name, "ip", "udp", "53")
+			By("Creating a suspended Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPol4)).Should(Succeed())
+			})
+			By("Checking the Segmentation Policy is suspended", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Suspended"))
+				Expect(meta.IsStatusConditionTrue(createdSegPol.Status.Conditions, ConditionSuspended)).Should(BeTrue())
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeFalse())
+			})
+			By("Resuming the Segmentation Policy", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Expect(k8sClient.Get(ctx, segPolLookupKey, createdSegPol)).Should(Succeed())
+				createdSegPol.Spec.Suspend = false
+				Expect(k8sClient.Update(ctx, createdSegPol)).Should(Succeed())
+			})
+			By("Checking the APIC objects are created", func() {
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeTrue())
+				Eventually(func() bool {
+					exists, _ := apicClient.EpgExists("ns-b", fmt.Sprintf(ApplicationProfileNamePrefix, cniConf.PolicyTenant), cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeTrue())
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+				Expect(meta.IsStatusConditionFalse(createdSegPol.Status.Conditions, ConditionSuspended)).Should(BeTrue())
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol4)).Should(Succeed())
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeFalse())
+			})
+		})
+	})
+
+	// The APIC objects of SegmentationPolicy #5 are kept once the policy is deleted
+	Context("When deleting a Segmentation Policy with the Retain deletion policy", func() {
+		It("Should keep the APIC objects without the annotations of the Segmentation Policy", func() {
+			segPol5 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol5",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces:     []string{"ns-c"},
+					Rules:          []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 22}},
+					DeletionPolicy: v1alpha1.DeletionPolicyRetain,
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol5.Name, Namespace: SegmentationPolicyNamespace}
+			filterName := fmt.Sprintf("%s_%s%s%s", segPol5.Name, "ip", "tcp", "22")
+			appName := fmt.Sprintf(ApplicationProfileNamePrefix, cniConf.PolicyTenant)
+			By("Creating the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPol5)).Should(Succeed())
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol5)).Should(Succeed())
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, segPolLookupKey, &v1alpha1.SegmentationPolicy{})
+					return err == nil
+				}, timeout, interval).Should(BeFalse())
+			})
+			By("Checking the APIC objects are kept", func() {
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+				exists, _ = apicClient.EpgExists("ns-c", appName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+			})
+			By("Checking the annotations of the Segmentation Policy are removed", func() {
+				filters, _ := apicClient.GetFilterWithAnnotation(cniConf.PolicyTenant, segPol5.Name)
+				Expect(filters).Should(BeEmpty())
+				tags, _ := apicClient.GetAnnotationsEpg("ns-c", appName, cniConf.PolicyTenant)
+				Expect(tags).ShouldNot(ContainElement(segPol5.Name))
+			})
+		})
+	})
+
+	// SegmentationPolicy #6 uses the name of a filter created on the APIC by another tool
+	Context("When creating a Segmentation Policy whose filter already exists on the APIC", func() {
+		It("Should only take ownership of the filter once the policy opts in", func() {
+			segPol6 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol6",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{"ns-a"},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 8080}},
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol6.Name, Namespace: SegmentationPolicyNamespace}
+			filterName := fmt.Sprintf("%s_%s%s%s", segPol6.Name, "ip", "tcp", "8080")
+			By("Creating the filter on the APIC", func() {
+				Expect(apicClient.CreateFilterAndFilterEntry(cniConf.PolicyTenant, filterName, "ip", "tcp", 8080)).Should(Succeed())
+			})
+			By("Creating the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPol6)).Should(Succeed())
+			})
+			By("Checking the Segmentation Policy reports the pre-existing filter", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Conflict"))
+				Expect(createdSegPol.Status.PreExisting).Should(Equal([]string{fmt.Sprintf("uni/tn-%s/flt-%s", cniConf.PolicyTenant, filterName)}))
+				Expect(meta.IsStatusConditionTrue(createdSegPol.Status.Conditions, ConditionPreExistingObjects)).Should(BeTrue())
+				filters, _ := apicClient.GetFilterWithAnnotation(cniConf.PolicyTenant, segPol6.Name)
+				Expect(filters).Should(BeEmpty())
+			})
+			By("Adopting the pre-existing objects", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Expect(k8sClient.Get(ctx, segPolLookupKey, createdSegPol)).Should(Succeed())
+				createdSegPol.Spec.AdoptExisting = true
+				Expect(k8sClient.Update(ctx, createdSegPol)).Should(Succeed())
+			})
+			By("Checking the filter is managed by the Segmentation Policy", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+				Expect(createdSegPol.Status.PreExisting).Should(BeEmpty())
+				filters, _ := apicClient.GetFilterWithAnnotation(cniConf.PolicyTenant, segPol6.Name)
+				Expect(filters).Should(Equal([]string{filterName}))
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol6)).Should(Succeed())
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeFalse())
+			})
+		})
+	})
+
+	// The EPG of SegmentationPolicy #7 is also tagged on the APIC by another tool
+	Context("When deleting a Segmentation Policy whose EPG has tags of other tools", func() {
+		It("Should delete the EPG once no Segmentation Policy references it", func() {
+			segPol7 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol7",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{"ns-b"},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 443}},
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol7.Name, Namespace: SegmentationPolicyNamespace}
+			appName := fmt.Sprintf(ApplicationProfileNamePrefix, cniConf.PolicyTenant)
+			By("Creating the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPol7)).Should(Succeed())
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+				Expect(createdSegPol.Status.EndpointGroups).Should(Equal([]string{"ns-b"}))
+			})
+			By("Tagging the EPG on the APIC", func() {
+				Expect(apicClient.AddTagAnnotationToEpg("ns-b", appName, cniConf.PolicyTenant, "owner", "network-team")).Should(Succeed())
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol7)).Should(Succeed())
+			})
+			By("Checking the EPG is deleted", func() {
+				Eventually(func() bool {
+					exists, _ := apicClient.EpgExists("ns-b", appName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeFalse())
+			})
+		})
+	})
+
+	// The Namespace of SegmentationPolicy #8 requests intra-EPG isolation
+	Context("When the Namespace of a Segmentation Policy sets the EPG settings", func() {
+		It("Should apply the settings to the EPG and revert them once removed", func() {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "ns-isolated",
+				Annotations: map[string]string{AnnotationIntraEpgIsolation: "true"},
+			}}
+			segPol8 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol8",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{ns.Name},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 9090}},
+				},
+			}
+			appName := fmt.Sprintf(ApplicationProfileNamePrefix, cniConf.PolicyTenant)
+			By("Creating the Namespace and the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, ns)).Should(Succeed())
+				Expect(k8sClient.Create(ctx, segPol8)).Should(Succeed())
+			})
+			By("Checking the EPG is isolated", func() {
+				Eventually(func() aci.EpgSettings {
+					settings, _ := apicClient.GetEpgSettings(ns.Name, appName, cniConf.PolicyTenant)
+					return settings
+				}, timeout, interval).Should(Equal(aci.EpgSettings{IntraEpgIsolation: true}))
+			})
+			By("Checking the Namespace records the setting enabled by the Operator", func() {
+				Eventually(func() string {
+					updatedNs := &corev1.Namespace{}
+					k8sClient.Get(ctx, types.NamespacedName{Name: ns.Name}, updatedNs)
+					return updatedNs.Annotations[AnnotationManagedEpgSettings]
+				}, timeout, interval).Should(Equal("intra-epg-isolation"))
+			})
+			By("Removing the annotation of the Namespace", func() {
+				updatedNs := &corev1.Namespace{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: ns.Name}, updatedNs)).Should(Succeed())
+				delete(updatedNs.Annotations, AnnotationIntraEpgIsolation)
+				Expect(k8sClient.Update(ctx, updatedNs)).Should(Succeed())
+			})
+			By("Checking the EPG is reverted to the default settings", func() {
+				Eventually(func() aci.EpgSettings {
+					settings, _ := apicClient.GetEpgSettings(ns.Name, appName, cniConf.PolicyTenant)
+					return settings
+				}, timeout, interval).Should(Equal(aci.EpgSettings{}))
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol8)).Should(Succeed())
+			})
+		})
+	})
+
+	// The preferred group of the EPG of SegmentationPolicy #10 is set on the APIC by another tool
+	Context("When the EPG settings are changed on the APIC", func() {
+		It("Should only revert the settings enabled by the Operator", func() {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "ns-preferred",
+				Annotations: map[string]string{AnnotationIntraEpgIsolation: "true"},
+			}}
+			segPol10 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol10",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{ns.Name},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 9191}},
+				},
+			}
+			appName := fmt.Sprintf(ApplicationProfileNamePrefix, cniConf.PolicyTenant)
+			By("Creating the Namespace and the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, ns)).Should(Succeed())
+				Expect(k8sClient.Create(ctx, segPol10)).Should(Succeed())
+			})
+			By("Checking the setting is recorded on the Namespace", func() {
+				Eventually(func() string {
+					updatedNs := &corev1.Namespace{}
+					k8sClient.Get(ctx, types.NamespacedName{Name: ns.Name}, updatedNs)
+					return updatedNs.Annotations[AnnotationManagedEpgSettings]
+				}, timeout, interval).Should(Equal("intra-epg-isolation"))
+			})
+			By("Adding the EPG to the preferred group on the APIC", func() {
+				settings := aci.EpgSettings{IntraEpgIsolation: true, PreferredGroup: true}
+				tenantMo := aci.TenantMo(cniConf.PolicyTenant).AddChild(aci.ApplicationProfileRefMo(appName).AddChild(aci.EndpointGroupRefMo(ns.Name).WithEpgSettings(settings)))
+				Expect(apicClient.PostTenantConfig(tenantMo)).Should(Succeed())
+			})
+			By("Removing the annotation of the Namespace", func() {
+				updatedNs := &corev1.Namespace{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: ns.Name}, updatedNs)).Should(Succeed())
+				delete(updatedNs.Annotations, AnnotationIntraEpgIsolation)
+				Expect(k8sClient.Update(ctx, updatedNs)).Should(Succeed())
+			})
+			By("Checking only the isolation is reverted", func() {
+				Eventually(func() aci.EpgSettings {
+					settings, _ := apicClient.GetEpgSettings(ns.Name, appName, cniConf.PolicyTenant)
+					return settings
+				}, timeout, interval).Should(Equal(aci.EpgSettings{PreferredGroup: true}))
+				Consistently(func() aci.EpgSettings {
+					settings, _ := apicClient.GetEpgSettings(ns.Name, appName, cniConf.PolicyTenant)
+					return settings
+				}, time.Second, interval).Should(Equal(aci.EpgSettings{PreferredGroup: true}))
+			})
+			By("Checking the Namespace no longer records the setting", func() {
+				Eventually(func() bool {
+					updatedNs := &corev1.Namespace{}
+					k8sClient.Get(ctx, types.NamespacedName{Name: ns.Name}, updatedNs)
+					_, ok := updatedNs.Annotations[AnnotationManagedEpgSettings]
+					return ok
+				}, timeout, interval).Should(BeFalse())
+			})
+			By("Deleting the Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol10)).Should(Succeed())
+			})
+		})
+	})
+
+	// The APIC is unreachable while SegmentationPolicy #11 is deleted
+	Context("When the APIC cleanup of a deleted Segmentation Policy fails", func() {
+		It("Should keep the finalizer until the cleanup succeeds", func() {
+			segPol11 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol11",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{"ns-c"},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 8444}},
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol11.Name, Namespace: SegmentationPolicyNamespace}
+			filterName := fmt.Sprintf("%s_%s%s%s", segPol11.Name, "ip", "tcp", "8444")
+			defer aci.ApicMockClient.SetPostTenantConfigError(nil)
+			By("Creating the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPol11)).Should(Succeed())
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+			})
+			By("Deleting the Segmentation Policy while the APIC is unreachable", func() {
+				aci.ApicMockClient.SetPostTenantConfigError(fmt.Errorf("dial tcp: connection refused"))
+				Expect(k8sClient.Delete(ctx, segPol11)).Should(Succeed())
+			})
+			By("Checking the failed cleanup is reported and the finalizer kept", func() {
+				deletedSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, deletedSegPol)
+					if condition := meta.FindStatusCondition(deletedSegPol.Status.Conditions, ConditionApicCleanup); condition != nil {
+						return condition.Reason
+					}
+					return ""
+				}, timeout, interval).Should(Equal(ReasonCleanupFailed))
+				Consistently(func() []string {
+					k8sClient.Get(ctx, segPolLookupKey, deletedSegPol)
+					return deletedSegPol.Finalizers
+				}, time.Second, interval).Should(ContainElement(finalizersSegPol))
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+			})
+			By("Checking the Segmentation Policy is removed once the APIC is reachable", func() {
+				aci.ApicMockClient.SetPostTenantConfigError(nil)
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, segPolLookupKey, &v1alpha1.SegmentationPolicy{})
+					return errors.IsNotFound(err)
+				}, timeout, interval).Should(BeTrue())
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeFalse())
+			})
+		})
+	})
+
+	// SegmentationPolicy #9 is deleted in dry-run mode: the cleanup is only planned until the dry-run annotation is removed
+	Context("When deleting a Segmentation Policy in dry-run mode", func() {
+		It("Should plan the deletion and keep the finalizer until the dry-run mode is disabled", func() {
+			segPol9 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol9",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{"ns-c"},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 8443}},
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol9.Name, Namespace: SegmentationPolicyNamespace}
+			filterName := fmt.Sprintf("%s_%s%s%s", segPol9.Name, "ip", "tcp", "8443")
+			By("Creating the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPol9)).Should(Succeed())
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+			})
+			By("Deleting the Segmentation Policy with the dry-run annotation", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Expect(k8sClient.Get(ctx, segPolLookupKey, createdSegPol)).Should(Succeed())
+				createdSegPol.Annotations = map[string]string{AnnotationDryRun: "true"}
+				Expect(k8sClient.Update(ctx, createdSegPol)).Should(Succeed())
+				Expect(k8sClient.Delete(ctx, createdSegPol)).Should(Succeed())
+			})
+			By("Checking the deletion is planned and the finalizer kept", func() {
+				deletedSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, deletedSegPol)
+					return deletedSegPol.Status.State
+				}, timeout, interval).Should(Equal("DeletionPlanned"))
+				Expect(deletedSegPol.Finalizers).Should(ContainElement(finalizersSegPol))
+				Expect(deletedSegPol.Status.Plan).Should(ContainElement(v1alpha1.PlannedChange{
+					Action: PlanActionDelete,
+					Class:  "vzFilter",
+					Dn:     fmt.Sprintf("uni/tn-%s/flt-%s", cniConf.PolicyTenant, filterName),
+				}))
+				exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+				Expect(exists).Should(BeTrue())
+			})
+			By("Removing the dry-run annotation", func() {
+				deletedSegPol := &v1alpha1.SegmentationPolicy{}
+				Expect(k8sClient.Get(ctx, segPolLookupKey, deletedSegPol)).Should(Succeed())
+				delete(deletedSegPol.Annotations, AnnotationDryRun)
+				Expect(k8sClient.Update(ctx, deletedSegPol)).Should(Succeed())
+			})
+			By("Checking the deletion is applied", func() {
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeFalse())
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, segPolLookupKey, &v1alpha1.SegmentationPolicy{})
+					return err == nil
+				}, timeout, interval).Should(BeFalse())
+			})
+		})
+	})
+
+	// The deletion of SegmentationPolicy #12 is applied although the policy is suspended
+	Context("When deleting a suspended Segmentation Policy", func() {
+		It("Should remove the APIC objects and the finalizer", func() {
+			segPol12 := &v1alpha1.SegmentationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "segpol12",
+					Namespace: SegmentationPolicyNamespace,
+				},
+				Spec: v1alpha1.SegmentationPolicySpec{
+					Namespaces: []string{"ns-c"},
+					Rules:      []v1alpha1.RuleSpec{{Eth: "ip", IP: "tcp", Port: 9443}},
+				},
+			}
+			segPolLookupKey := types.NamespacedName{Name: segPol12.Name, Namespace: SegmentationPolicyNamespace}
+			filterName := fmt.Sprintf("%s_%s%s%s", segPol12.Name, "ip", "tcp", "9443")
+			By("Creating the Segmentation Policy", func() {
+				Expect(k8sClient.Create(ctx, segPol12)).Should(Succeed())
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Enforced"))
+			})
+			By("Suspending the Segmentation Policy", func() {
+				createdSegPol := &v1alpha1.SegmentationPolicy{}
+				Expect(k8sClient.Get(ctx, segPolLookupKey, createdSegPol)).Should(Succeed())
+				createdSegPol.Spec.Suspend = true
+				Expect(k8sClient.Update(ctx, createdSegPol)).Should(Succeed())
+				Eventually(func() string {
+					k8sClient.Get(ctx, segPolLookupKey, createdSegPol)
+					return createdSegPol.Status.State
+				}, timeout, interval).Should(Equal("Suspended"))
+			})
+			By("Deleting the suspended Segmentation Policy", func() {
+				Expect(k8sClient.Delete(ctx, segPol12)).Should(Succeed())
+			})
+			By("Checking the APIC objects and the finalizer are removed", func() {
+				Eventually(func() bool {
+					exists, _ := apicClient.FilterExists(filterName, cniConf.PolicyTenant)
+					return exists
+				}, timeout, interval).Should(BeFalse())
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, segPolLookupKey, &v1alpha1.SegmentationPolicy{})
+					return err == nil
+				}, timeout, interval).Should(BeFalse())
+			})
+		})
+	})
 })
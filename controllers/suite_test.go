@@ -23,12 +23,16 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -48,6 +52,8 @@ var (
 	cancel     context.CancelFunc
 	apicClient aci.ApicInterface
 	cniConf    AciCniConfig
+	// Spans of the reconciles and APIC calls
+	spanExporter *tracetest.InMemoryExporter
 )
 
 func TestAPIs(t *testing.T) {
@@ -99,11 +105,34 @@ var _ = BeforeSuite(func() {
 		EPGKubeDefault:                "my-test-epg",
 		ApplicationProfileKubeDefault: "my-test-app"}
 
+	spanExporter = tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+
+	cniConfigStore := NewCniConfigStore(cniConf, nil)
+	cniConfigEvents := make(chan event.GenericEvent)
 	err = (&SegmentationPolicyReconciler{
+		Client:          k8sManager.GetClient(),
+		Scheme:          k8sManager.GetScheme(),
+		ApicClient:      aci.NewHookedClient(apicClient, aci.TracingHook()),
+		CniConfig:       cniConfigStore,
+		CniConfigEvents: cniConfigEvents,
+		Recorder:        k8sManager.GetEventRecorderFor("segmentationpolicy-controller"),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&NamespaceEndpointGroupReconciler{
+		Client:     k8sManager.GetClient(),
+		ApicClient: aci.NewHookedClient(apicClient, aci.TracingHook()),
+		CniConfig:  cniConfigStore,
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&CniConfigReconciler{
 		Client:     k8sManager.GetClient(),
-		Scheme:     k8sManager.GetScheme(),
-		ApicClient: apicClient,
-		CniConfig:  cniConf,
+		Provider:   &AciCniConfigMapProvider{Reader: k8sManager.GetAPIReader()},
+		CniConfig:  cniConfigStore,
+		ApicClient: &aci.ApicMockClient,
+		Events:     cniConfigEvents,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,78 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
+)
+
+const (
+	// Condition of the SegmentationPolicies reporting whether the changes to the APIC are suspended
+	ConditionSuspended = "Suspended"
+
+	ReasonSuspended = "Suspended"
+	ReasonResumed   = "Resumed"
+)
+
+// Report the suspension of the SegmentationPolicy. Neither the APIC nor the Namespaces are modified. Deleted policies are not
+// suspended: their deletion policy is applied and the finalizer removed
+func (r *SegmentationPolicyReconciler) suspend(ctx context.Context, segPol *v1alpha1.SegmentationPolicy) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	if meta.IsStatusConditionTrue(segPol.Status.Conditions, ConditionSuspended) && segPol.Status.State == "Suspended" {
+		return ctrl.Result{}, nil
+	}
+	logger.Info(fmt.Sprintf("Segmentation Policy %s suspended", segPol.Name))
+	segPol.Status.State = "Suspended"
+	meta.SetStatusCondition(&segPol.Status.Conditions, metav1.Condition{
+		Type:               ConditionSuspended,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonSuspended,
+		Message:            "Changes to the APIC are suspended",
+		ObservedGeneration: segPol.Generation,
+	})
+	if err := r.Status().Update(ctx, segPol); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error occurred while setting the status: %w", err)
+	}
+	policyStates.set(types.NamespacedName{Namespace: segPol.Namespace, Name: segPol.Name}, segPol.Status.State)
+	r.event(segPol, corev1.EventTypeNormal, ReasonSuspended, "Changes to the APIC are suspended")
+	return ctrl.Result{}, nil
+}
+
+// Clear the Suspended condition of a resumed SegmentationPolicy. The status is updated by the rest of the reconcile
+func (r *SegmentationPolicyReconciler) resume(segPol *v1alpha1.SegmentationPolicy) {
+	if !meta.IsStatusConditionTrue(segPol.Status.Conditions, ConditionSuspended) {
+		return
+	}
+	meta.SetStatusCondition(&segPol.Status.Conditions, metav1.Condition{
+		Type:               ConditionSuspended,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonResumed,
+		Message:            "Changes to the APIC are applied",
+		ObservedGeneration: segPol.Generation,
+	})
+	r.event(segPol, corev1.EventTypeNormal, ReasonResumed, "Resumed. Reconciling all the APIC objects of the policy")
+}
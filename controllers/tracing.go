@@ -0,0 +1,58 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
+)
+
+const tracerName = "github.com/jgomezve/aci-k8s-operator/controllers"
+
+// Attribute of the spans with the SegmentationPolicy being reconciled
+const AttributeSegmentationPolicy = attribute.Key("segmentationpolicy")
+
+// Spans of the reconciles and their phases. The global TracerProvider is read on every span, so that it can be set after the controllers are created
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// APIC client whose calls are traced as children of the span of the context
+func (r *SegmentationPolicyReconciler) apic(ctx context.Context) aci.ApicInterface {
+	return apicWithContext(ctx, r.ApicClient)
+}
+
+func apicWithContext(ctx context.Context, apicClient aci.ApicInterface) aci.ApicInterface {
+	if client, ok := apicClient.(aci.ContextClient); ok {
+		return client.WithContext(ctx)
+	}
+	return apicClient
+}
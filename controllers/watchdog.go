@@ -0,0 +1,71 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReconcileWatchdog tracks the reconciles in progress. The liveness check fails if a reconcile runs longer than the timeout,
+// e.g. blocked on a request to the APIC, so that the Pod is restarted
+type ReconcileWatchdog struct {
+	timeout  time.Duration
+	lock     sync.Mutex
+	next     uint64
+	inFlight map[uint64]reconcileRun
+}
+
+type reconcileRun struct {
+	name  string
+	start time.Time
+}
+
+func NewReconcileWatchdog(timeout time.Duration) *ReconcileWatchdog {
+	return &ReconcileWatchdog{timeout: timeout, inFlight: map[uint64]reconcileRun{}}
+}
+
+// Register the start of a reconcile. The returned function must be called when the reconcile ends. A nil watchdog tracks nothing
+func (w *ReconcileWatchdog) Start(name string) func() {
+	if w == nil {
+		return func() {}
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	id := w.next
+	w.next++
+	w.inFlight[id] = reconcileRun{name: name, start: time.Now()}
+	return func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		delete(w.inFlight, id)
+	}
+}
+
+// Liveness check reporting the reconciles running longer than the timeout
+func (w *ReconcileWatchdog) HealthzCheck(_ *http.Request) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, run := range w.inFlight {
+		if elapsed := time.Since(run.start); elapsed > w.timeout {
+			return fmt.Errorf("reconcile of %s running for %s", run.name, elapsed.Round(time.Second))
+		}
+	}
+	return nil
+}
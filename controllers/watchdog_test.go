@@ -0,0 +1,53 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The liveness check fails while a reconcile runs longer than the timeout
+
+var _ = Describe("Reconcile watchdog", func() {
+	const timeout = time.Millisecond * 200
+
+	Context("When a reconcile runs", func() {
+		It("Should only fail the liveness check past the timeout", func() {
+			watchdog := NewReconcileWatchdog(timeout)
+			done := watchdog.Start("SegmentationPolicy default/segpol")
+			By("Checking the liveness within the timeout", func() {
+				Expect(watchdog.HealthzCheck(nil)).Should(Succeed())
+			})
+			By("Checking the liveness past the timeout", func() {
+				Eventually(func() error {
+					return watchdog.HealthzCheck(nil)
+				}, 2*timeout, timeout/10).Should(MatchError(ContainSubstring("reconcile of SegmentationPolicy default/segpol running for")))
+			})
+			By("Ending the reconcile", func() {
+				done()
+				Expect(watchdog.HealthzCheck(nil)).Should(Succeed())
+			})
+		})
+	})
+
+	Context("When the watchdog is not set", func() {
+		It("Should not track the reconciles", func() {
+			var watchdog *ReconcileWatchdog
+			Expect(watchdog.Start("SegmentationPolicy default/segpol")).ShouldNot(BeNil())
+		})
+	})
+})
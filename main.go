@@ -22,10 +22,13 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -35,18 +38,24 @@ import (
 	"k8s.io/client-go/rest"
 	remotecommand "k8s.io/client-go/tools/remotecommand"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	configv1alpha1 "github.com/jgomezve/aci-k8s-operator/api/config/v1alpha1"
 	apicv1alpha1 "github.com/jgomezve/aci-k8s-operator/api/v1alpha1"
 	"github.com/jgomezve/aci-k8s-operator/controllers"
 	"github.com/jgomezve/aci-k8s-operator/pkg/aci"
-	"github.com/tidwall/gjson"
+	"github.com/jgomezve/aci-k8s-operator/pkg/tracing"
 	//+kubebuilder:scaffold:imports
 )
 
+// Events of a change of the ACI CNI configuration buffered for the SegmentationPolicy controller
+const cniConfigEventsBuffer = 1024
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -58,24 +67,46 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(apicv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 
 	user, password = os.Getenv("APIC_USERNAME"), os.Getenv("APIC_PASSWORD")
 }
 
-func getApicInformation(c client.Client, r rest.Interface, rc *rest.Config, s *runtime.Scheme) (controllers.AciCniConfig, error) {
+// Build the provider of the ACI parameters. The aci-cni provider watches the ConfigMap of the ACI CNI, the static provider uses the parameters
+// of the configuration file, environment variables and flags
+func getCniConfigProvider(c client.Reader, provider string, aciConfig configv1alpha1.AciConfig) (controllers.CniConfigProvider, error) {
+	switch provider {
+	case "", configv1alpha1.ProviderAciCni:
+		return &controllers.AciCniConfigMapProvider{Reader: c}, nil
+	case configv1alpha1.ProviderStatic:
+		return &controllers.StaticCniConfigProvider{Config: controllers.AciCniConfig{
+			ApicHosts:                     aciConfig.ApicHosts,
+			ApicUsername:                  aciConfig.ApicUsername,
+			PolicyTenant:                  aciConfig.PolicyTenant,
+			PodBridgeDomain:               aciConfig.PodBridgeDomain,
+			KubernetesVmmDomain:           aciConfig.VmmDomain,
+			ApplicationProfileKubeDefault: aciConfig.DefaultApplicationProfile,
+			EPGKubeDefault:                aciConfig.DefaultEndpointGroup,
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown ACI configuration provider %s", provider)
+}
 
-	// Read CNI Connfiguration from ConfigMap
-	configMap := &corev1.ConfigMapList{}
-	err := c.List(context.TODO(), configMap, client.InNamespace("aci-containers-system"), client.MatchingFields{"metadata.name": "aci-containers-config"})
-	if err != nil {
-		return controllers.AciCniConfig{}, fmt.Errorf(fmt.Sprintf("Error reading ConfigMap aci-containers-config %s", err))
+// Replace the value if the override is set
+func override(value *string, override string) {
+	if override != "" {
+		*value = override
 	}
+}
+
+// Legacy: read the APIC private key from the ACI CNI controller Pod. Requires the pods/exec permission
+func getApicPrivateKey(c client.Client, r rest.Interface, rc *rest.Config, s *runtime.Scheme, keyPath string) (string, error) {
 	// Get the name of the controller Pod
 	pods := &corev1.PodList{}
-	err = c.List(context.TODO(), pods, client.InNamespace("aci-containers-system"))
+	err := c.List(context.TODO(), pods, client.InNamespace("aci-containers-system"))
 	if err != nil {
-		return controllers.AciCniConfig{}, fmt.Errorf(fmt.Sprintf("Error reading Controller Pod %s", err))
+		return "", fmt.Errorf(fmt.Sprintf("Error reading Controller Pod %s", err))
 	}
 	podController := ""
 	for _, pod := range pods.Items {
@@ -85,7 +116,7 @@ func getApicInformation(c client.Client, r rest.Interface, rc *rest.Config, s *r
 		}
 	}
 	if podController == "" {
-		return controllers.AciCniConfig{}, fmt.Errorf(" Controller Pod not found")
+		return "", fmt.Errorf(" Controller Pod not found")
 	}
 	// Get the private key from the Controller Pod
 	execReq := r.Post().
@@ -94,7 +125,7 @@ func getApicInformation(c client.Client, r rest.Interface, rc *rest.Config, s *r
 		Name(podController).
 		SubResource("exec").
 		VersionedParams(&corev1.PodExecOptions{
-			Command: []string{"/bin/sh", "-c", fmt.Sprintf("cat %s", gjson.Get(configMap.Items[0].Data["controller-config"], "apic-private-key-path").String())},
+			Command: []string{"/bin/sh", "-c", fmt.Sprintf("cat %s", keyPath)},
 			Stdin:   false,
 			Stdout:  true,
 			Stderr:  true,
@@ -102,7 +133,7 @@ func getApicInformation(c client.Client, r rest.Interface, rc *rest.Config, s *r
 
 	exec, err := remotecommand.NewSPDYExecutor(rc, "POST", execReq.URL())
 	if err != nil {
-		return controllers.AciCniConfig{}, fmt.Errorf(fmt.Sprintf("Error setting up remote command %s", err))
+		return "", fmt.Errorf(fmt.Sprintf("Error setting up remote command %s", err))
 	}
 	cert := new(strings.Builder)
 	err = exec.Stream(remotecommand.StreamOptions{
@@ -111,31 +142,178 @@ func getApicInformation(c client.Client, r rest.Interface, rc *rest.Config, s *r
 		Tty:    false,
 	})
 	if err != nil {
-		return controllers.AciCniConfig{}, fmt.Errorf(fmt.Sprintf("Error executing command on Controller Pod %s", err))
-	}
-
-	return controllers.AciCniConfig{
-		ApicIp:                        gjson.Get(configMap.Items[0].Data["controller-config"], "apic-hosts.1").String(),
-		ApicUsername:                  gjson.Get(configMap.Items[0].Data["controller-config"], "apic-username").String(),
-		ApicPrivateKey:                cert.String(),
-		KeyPath:                       gjson.Get(configMap.Items[0].Data["controller-config"], "apic-private-key-path").String(),
-		PolicyTenant:                  gjson.Get(configMap.Items[0].Data["controller-config"], "aci-policy-tenant").String(),
-		PodBridgeDomain:               strings.Replace(strings.Split(gjson.Get(configMap.Items[0].Data["controller-config"], "aci-podbd-dn").String(), "/")[2], "BD-", "", -1),
-		KubernetesVmmDomain:           gjson.Get(configMap.Items[0].Data["controller-config"], "aci-vmm-domain").String(),
-		ApplicationProfileKubeDefault: gjson.Get(configMap.Items[0].Data["host-agent-config"], "app-profile").String(),
-		EPGKubeDefault:                strings.Split(gjson.Get(configMap.Items[0].Data["host-agent-config"], "default-endpoint-group.name").String(), "|")[1],
+		return "", fmt.Errorf(fmt.Sprintf("Error executing command on Controller Pod %s", err))
+	}
+
+	return cert.String(), nil
+}
+
+// Build the source of the APIC credentials. The credentials Secret is preferred. Otherwise fall back to the APIC_PASSWORD
+// environment variable or the private key of the ACI CNI controller Pod. The username and the path of the private key are resolved from
+// the current ACI CNI configuration on every read, so that the APIC client logs in again when they change
+func getApicCredentials(c client.Client, apiReader client.Reader, r rest.Interface, rc *rest.Config, s *runtime.Scheme, cniConfig *controllers.CniConfigStore, credentialsSecret string) (aci.CredentialsSource, error) {
+	username := func() string {
+		cniConf, _ := cniConfig.Get()
+		return cniConf.ApicUsername
+	}
+	if credentialsSecret != "" {
+		namespace, name, err := splitNamespacedName(credentialsSecret)
+		if err != nil {
+			return nil, err
+		}
+		return aci.CredentialsFromSecret(apiReader, namespace, name, username), nil
+	}
+	if password != "" {
+		setupLog.Info("WARNING: reading the APIC password from APIC_PASSWORD is deprecated, use --apic-credentials-secret")
+		return func(_ context.Context) (aci.Credentials, error) {
+			return aci.Credentials{Username: username(), Password: password}, nil
+		}, nil
+	}
+	setupLog.Info("WARNING: reading the APIC private key from the ACI CNI controller Pod is deprecated, use --apic-credentials-secret")
+	// The private key is only read again from the Pod when its path changes
+	var lock sync.Mutex
+	keyPath, privateKey := "", ""
+	return func(_ context.Context) (aci.Credentials, error) {
+		cniConf, _ := cniConfig.Get()
+		if cniConf.KeyPath == "" {
+			return aci.Credentials{}, fmt.Errorf("no APIC credentials defined, use --apic-credentials-secret")
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if cniConf.KeyPath != keyPath {
+			key, err := getApicPrivateKey(c, r, rc, s, cniConf.KeyPath)
+			if err != nil {
+				return aci.Credentials{}, err
+			}
+			keyPath, privateKey = cniConf.KeyPath, key
+		}
+		return aci.Credentials{Username: cniConf.ApicUsername, PrivateKey: privateKey}, nil
 	}, nil
 }
 
+// Build the TLS settings of the APIC connections. At most one CA bundle source can be configured
+func getApicTLSConfig(c client.Reader, insecure bool, caFile, caSecret, caConfigMap, caKey, serverName string) (aci.TLSConfig, error) {
+	tlsConfig := aci.TLSConfig{Insecure: insecure, ServerName: serverName}
+	sources := 0
+	if caFile != "" {
+		tlsConfig.CABundle = aci.CABundleFromFile(caFile)
+		sources++
+	}
+	if caSecret != "" {
+		namespace, name, err := splitNamespacedName(caSecret)
+		if err != nil {
+			return aci.TLSConfig{}, err
+		}
+		tlsConfig.CABundle = aci.CABundleFromSecret(c, namespace, name, caKey)
+		sources++
+	}
+	if caConfigMap != "" {
+		namespace, name, err := splitNamespacedName(caConfigMap)
+		if err != nil {
+			return aci.TLSConfig{}, err
+		}
+		tlsConfig.CABundle = aci.CABundleFromConfigMap(c, namespace, name, caKey)
+		sources++
+	}
+	if sources > 1 {
+		return aci.TLSConfig{}, fmt.Errorf("only one of --apic-ca-file, --apic-ca-secret and --apic-ca-configmap can be set")
+	}
+	if insecure {
+		setupLog.Info("WARNING: the APIC certificate is not verified")
+	}
+	return tlsConfig, nil
+}
+
+func splitNamespacedName(namespacedName string) (string, string, error) {
+	parts := strings.Split(namespacedName, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%s is not in the format <namespace>/<name>", namespacedName)
+	}
+	return parts[0], parts[1], nil
+}
+
+// Audit sinks configured with the flags. Nil if the audit is disabled
+func getAuditSink(mgr ctrl.Manager, auditLog, auditConfigMap string, maxRecords int) (aci.AuditSink, error) {
+	sinks := aci.MultiSink{}
+	if auditLog != "" {
+		sink, err := aci.NewAuditLogSink(auditLog)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if auditConfigMap != "" {
+		namespace, name, err := splitNamespacedName(auditConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, &aci.ConfigMapSink{Reader: mgr.GetAPIReader(), Writer: mgr.GetClient(), Namespace: namespace, Name: name, MaxRecords: maxRecords})
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return sinks, nil
+}
+
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var apicInsecure bool
+	var apicCAFile, apicCASecret, apicCAConfigMap, apicCAKey, apicServerName string
+	var apicCredentialsSecret string
+	var configFile, aciProvider, apicHosts string
+	var reconcileTimeout time.Duration
+	var otlpEndpoint string
+	var otlpInsecure bool
+	var auditLog, auditConfigMap string
+	var auditConfigMapMaxRecords int
+	var auditCompare bool
+	var dryRun bool
+	var clusterID string
+	var gcInterval, gcGracePeriod time.Duration
+	var epgResyncInterval time.Duration
+	var gcDelete bool
+	var aciFlags configv1alpha1.AciConfig
+	flag.StringVar(&configFile, "config", "",
+		"The controller will load its initial configuration from this file. "+
+			"Omit this flag to use the default configuration values. "+
+			"Command-line flags override configuration from this file.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&apicInsecure, "apic-insecure", false, "Skip the verification of the APIC certificate. Not recommended for production environments.")
+	flag.StringVar(&apicCAFile, "apic-ca-file", "", "Path to the PEM encoded CA bundle used to verify the APIC certificate.")
+	flag.StringVar(&apicCASecret, "apic-ca-secret", "", "Secret (<namespace>/<name>) holding the CA bundle used to verify the APIC certificate.")
+	flag.StringVar(&apicCAConfigMap, "apic-ca-configmap", "", "ConfigMap (<namespace>/<name>) holding the CA bundle used to verify the APIC certificate.")
+	flag.StringVar(&apicCAKey, "apic-ca-key", "ca.crt", "Key of the CA bundle in the Secret/ConfigMap.")
+	flag.StringVar(&apicCredentialsSecret, "apic-credentials-secret", "", "Secret (<namespace>/<name>) holding the APIC credentials. The Secret is not watched but read every 60s: changes are applied without restart, up to 60s later.")
+	flag.StringVar(&apicServerName, "apic-server-name", "", "Name used to verify the APIC certificate instead of the APIC host.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 10*time.Minute, "Reconciles running longer than this are considered stuck and fail the liveness check.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/gRPC collector (<host>:<port>) receiving the traces. Tracing is also enabled by the OTEL_EXPORTER_OTLP_* environment variables.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Send the traces to the OTLP collector without TLS.")
+	flag.StringVar(&auditLog, "audit-log", "", "File where the changes made on the APIC are recorded as JSON lines. \"-\" writes them to stdout.")
+	flag.StringVar(&auditConfigMap, "audit-configmap", "", "ConfigMap (<namespace>/<name>) keeping the last changes made on the APIC. It must be in the namespace of the operator, where the audit-role Role grants create and update on ConfigMaps.")
+	flag.IntVar(&auditConfigMapMaxRecords, "audit-configmap-max-records", 100, "Number of changes kept in the audit ConfigMap.")
+	flag.BoolVar(&auditCompare, "audit-compare", false, "Read the objects on the APIC before each change to record only the attributes which change. "+
+		"Adds a read of the APIC per object changed.")
+	flag.DurationVar(&gcInterval, "gc-interval", 10*time.Minute, "Interval between the searches of APIC objects of deleted SegmentationPolicies. 0 disables the garbage collector.")
+	flag.DurationVar(&gcGracePeriod, "gc-grace-period", time.Hour, "Time an APIC object must stay orphaned before the garbage collector deletes it.")
+	flag.BoolVar(&gcDelete, "gc-delete", false, "Delete the orphaned APIC objects. Otherwise they are only reported in the logs and metrics.")
+	flag.DurationVar(&epgResyncInterval, "epg-resync-interval", 10*time.Minute, "Interval between the reads of the EPGs from the APIC reported by the NamespaceEndpointGroups. 0 disables them.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Report the changes of the SegmentationPolicies in their status without applying them to the APIC.")
+	flag.StringVar(&clusterID, "cluster-id", os.Getenv("CLUSTER_ID"), "Identity of the cluster stamped in the names and tags of its APIC objects. Required if several clusters share the policy tenant.")
+	// ACI parameters. Flags take precedence over environment variables, and these over the configuration file
+	flag.StringVar(&aciProvider, "aci-config-provider", os.Getenv("ACI_CONFIG_PROVIDER"), "Source of the ACI parameters: aci-cni (ConfigMap of the ACI CNI, default) or static (configuration file, environment variables and flags).")
+	flag.StringVar(&apicHosts, "apic-hosts", os.Getenv("APIC_HOSTS"), "Comma-separated list of APIC controllers (static provider).")
+	flag.StringVar(&aciFlags.ApicUsername, "apic-username", user, "APIC user if not defined in the credentials Secret (static provider).")
+	flag.StringVar(&aciFlags.PolicyTenant, "aci-tenant", os.Getenv("ACI_TENANT"), "Tenant where the APIC objects are created (static provider).")
+	flag.StringVar(&aciFlags.PodBridgeDomain, "aci-pod-bd", os.Getenv("ACI_POD_BD"), "Bridge Domain of the Pods (static provider).")
+	flag.StringVar(&aciFlags.VmmDomain, "aci-vmm-domain", os.Getenv("ACI_VMM_DOMAIN"), "VMM Domain of the Kubernetes cluster (static provider).")
+	flag.StringVar(&aciFlags.DefaultApplicationProfile, "aci-default-app-profile", os.Getenv("ACI_DEFAULT_APP_PROFILE"), "Application Profile of the default EPG (static provider).")
+	flag.StringVar(&aciFlags.DefaultEndpointGroup, "aci-default-epg", os.Getenv("ACI_DEFAULT_EPG"), "EPG whose contracts are inherited by the SegmentationPolicy EPGs (static provider).")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -144,7 +322,14 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if err := controllers.ValidateClusterID(clusterID); err != nil {
+		setupLog.Error(err, "unable to start the operator")
+		os.Exit(1)
+	}
+
+	var err error
+	operatorConfig := configv1alpha1.OperatorConfig{}
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
@@ -153,7 +338,37 @@ func main() {
 		LeaderElectionID:       "1d45f356.aci.cisco",
 		// Disable cache for configMaps/Pods as we need to read ACI Configuration before starting the Manager/Controllers
 		ClientDisableCacheFor: []client.Object{&corev1.ConfigMap{}, &corev1.Pod{}},
-	})
+		// Only the ACI CNI ConfigMap is watched
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.ConfigMap{}: {Field: fields.SelectorFromSet(fields.Set{
+					"metadata.namespace": controllers.CniConfigMapNamespace,
+					"metadata.name":      controllers.CniConfigMapName,
+				})},
+			},
+		}),
+	}
+	if configFile != "" {
+		options, err = options.AndFrom(ctrl.ConfigFile().AtPath(configFile).OfKind(&operatorConfig))
+		if err != nil {
+			setupLog.Error(err, "unable to load the config file")
+			os.Exit(1)
+		}
+	}
+	provider := operatorConfig.Provider
+	override(&provider, aciProvider)
+	aciConfig := operatorConfig.Aci
+	if apicHosts != "" {
+		aciConfig.ApicHosts = strings.Split(apicHosts, ",")
+	}
+	override(&aciConfig.ApicUsername, aciFlags.ApicUsername)
+	override(&aciConfig.PolicyTenant, aciFlags.PolicyTenant)
+	override(&aciConfig.PodBridgeDomain, aciFlags.PodBridgeDomain)
+	override(&aciConfig.VmmDomain, aciFlags.VmmDomain)
+	override(&aciConfig.DefaultApplicationProfile, aciFlags.DefaultApplicationProfile)
+	override(&aciConfig.DefaultEndpointGroup, aciFlags.DefaultEndpointGroup)
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
@@ -165,27 +380,136 @@ func main() {
 	}
 
 	restClient, _ := apiutil.RESTClientForGVK(gvk, false, mgr.GetConfig(), serializer.NewCodecFactory(mgr.GetScheme()))
-	cniConf, err := getApicInformation(mgr.GetClient(), restClient, mgr.GetConfig(), mgr.GetScheme())
+	// SegmentationPolicies are blocked until the configuration is valid
+	cniConfigProvider, err := getCniConfigProvider(mgr.GetAPIReader(), provider, aciConfig)
 	if err != nil {
-		setupLog.Error(err, "unable to read ACI CNI configuration")
+		setupLog.Error(err, "invalid ACI configuration provider")
+		os.Exit(1)
+	}
+	// Static parameters are only loaded on start-up
+	_, watched := cniConfigProvider.(controllers.WatchedCniConfigProvider)
+	cniConf, cniErr := cniConfigProvider.Load(context.TODO())
+	if cniErr != nil && !watched {
+		setupLog.Error(cniErr, "invalid ACI configuration")
+		os.Exit(1)
+	} else if cniErr != nil {
+		setupLog.Error(cniErr, "invalid ACI CNI configuration")
+	} else {
+		setupLog.Info(fmt.Sprintf("ACI CNI configuration discovered for tenant %s in APIC controllers %s", cniConf.PolicyTenant, strings.Join(cniConf.ApicHosts, ", ")))
 	}
-	setupLog.Info(fmt.Sprintf("ACI CNI configuration discovered for tenant %s in APIC controller %s", cniConf.PolicyTenant, cniConf.ApicIp))
 
-	apicClient, err := aci.NewApicClient(cniConf.ApicIp, cniConf.ApicUsername, password, cniConf.ApicPrivateKey)
+	tlsConfig, err := getApicTLSConfig(mgr.GetAPIReader(), apicInsecure, apicCAFile, apicCASecret, apicCAConfigMap, apicCAKey, apicServerName)
 	if err != nil {
+		setupLog.Error(err, "invalid APIC TLS configuration")
+		os.Exit(1)
+	}
+
+	// The credentials are resolved from the ACI CNI configuration of the store
+	cniConfigStore := controllers.NewCniConfigStore(cniConf, cniErr)
+	credentials, err := getApicCredentials(mgr.GetClient(), mgr.GetAPIReader(), restClient, mgr.GetConfig(), mgr.GetScheme(), cniConfigStore, apicCredentialsSecret)
+	if err != nil {
+		setupLog.Error(err, "unable to read the APIC credentials")
+		os.Exit(1)
+	}
+
+	apicClient, err := aci.NewApicClient(cniConf.ApicHosts, credentials, tlsConfig)
+	if apicClient == nil {
 		setupLog.Error(err, "unable to setup the Apic Client")
 		os.Exit(1)
 	}
+	if err != nil && !watched {
+		setupLog.Error(err, "unable to login to the APIC")
+		os.Exit(1)
+	}
+	if err != nil && cniErr == nil {
+		// The CniConfigReconciler retries the login
+		cniErr = fmt.Errorf("unable to login to the APIC controllers %s: %w", strings.Join(cniConf.ApicHosts, ", "), err)
+		setupLog.Error(err, "unable to login to the APIC")
+		cniConfigStore.Set(cniConf, cniErr)
+	}
+	// Trace the reconciles and the APIC calls
+	shutdownTracing := func() error { return nil }
+	if tracing.Enabled(otlpEndpoint) {
+		if shutdownTracing, err = tracing.Setup(context.Background(), otlpEndpoint, otlpInsecure); err != nil {
+			setupLog.Error(err, "unable to set up the OTLP trace exporter")
+			os.Exit(1)
+		}
+	}
+
+	// Keep the APIC session alive and health check the APIC cluster while the manager runs
+	if err := mgr.Add(apicClient); err != nil {
+		setupLog.Error(err, "unable to set up the APIC session refresh")
+		os.Exit(1)
+	}
+
+	// Trace, measure and audit the APIC calls
+	hooks := []aci.Hook{aci.TracingHook(), aci.MetricsHook()}
+	if auditSink, err := getAuditSink(mgr, auditLog, auditConfigMap, auditConfigMapMaxRecords); err != nil {
+		setupLog.Error(err, "unable to set up the audit log")
+		os.Exit(1)
+	} else if auditSink != nil {
+		hooks = append(hooks, aci.AuditHook(auditSink, auditCompare))
+	}
+	hookedClient := aci.NewHookedClient(apicClient, hooks...)
 
+	watchdog := controllers.NewReconcileWatchdog(reconcileTimeout)
+	// The events of a configuration change are sent asynchronously by the CniConfigReconciler. The buffer lets the goroutine sending them
+	// end before the SegmentationPolicy controller consumes them
+	cniConfigEvents := make(chan event.GenericEvent, cniConfigEventsBuffer)
 	if err = (&controllers.SegmentationPolicyReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		ApicClient: apicClient,
-		CniConfig:  cniConf,
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		ApicClient:      hookedClient,
+		CniConfig:       cniConfigStore,
+		CniConfigEvents: cniConfigEvents,
+		Watchdog:        watchdog,
+		Recorder:        mgr.GetEventRecorderFor("segmentationpolicy-controller"),
+		DryRun:          dryRun,
+		ClusterID:       clusterID,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SegmentationPolicy")
 		os.Exit(1)
 	}
+	if err = (&controllers.NamespaceEndpointGroupReconciler{
+		Client:         mgr.GetClient(),
+		ApicClient:     hookedClient,
+		CniConfig:      cniConfigStore,
+		ClusterID:      clusterID,
+		Watchdog:       watchdog,
+		ResyncInterval: epgResyncInterval,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NamespaceEndpointGroup")
+		os.Exit(1)
+	}
+	if watched {
+		if err = (&controllers.CniConfigReconciler{
+			Client:     mgr.GetClient(),
+			Provider:   cniConfigProvider.(controllers.WatchedCniConfigProvider),
+			CniConfig:  cniConfigStore,
+			ApicClient: apicClient,
+			Events:     cniConfigEvents,
+			Watchdog:   watchdog,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CniConfig")
+			os.Exit(1)
+		}
+	}
+
+	// Orphans are never deleted in dry-run mode
+	if gcInterval > 0 {
+		if err := mgr.Add(&controllers.GarbageCollector{
+			Client:      mgr.GetClient(),
+			ApicClient:  hookedClient,
+			CniConfig:   cniConfigStore,
+			Interval:    gcInterval,
+			GracePeriod: gcGracePeriod,
+			Delete:      gcDelete && !dryRun,
+			ClusterID:   clusterID,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up the garbage collector")
+			os.Exit(1)
+		}
+	}
 
 	//+kubebuilder:scaffold:builder
 
@@ -197,9 +521,27 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddHealthzCheck("reconcile", watchdog.HealthzCheck); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	// Not ready while the APIC session is not valid, the active APIC is not reachable or the ACI CNI configuration is not valid
+	if err := mgr.AddReadyzCheck("apic", apicClient.ReadyzCheck); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("cni-config", cniConfigStore.ReadyzCheck); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+	// Flush the pending spans
+	if err := shutdownTracing(); err != nil {
+		setupLog.Error(err, "unable to flush the traces")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
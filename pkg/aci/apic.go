@@ -1,22 +1,54 @@
 package aci
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ciscoecosystem/aci-go-client/client"
+	"github.com/ciscoecosystem/aci-go-client/container"
 	"github.com/ciscoecosystem/aci-go-client/models"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/jgomezve/aci-k8s-operator/pkg/utils"
 )
 
 type ApicClient struct {
-	host     string
-	user     string
-	password string
-	client   *client.Client
+	*apicState
+	// Status of the requests of the call the client is bound to. Nil for the client shared by all the calls
+	status *statusRecorder
+}
+
+// State of the APIC client shared by all the calls
+type apicState struct {
+	// APICs of the cluster. Requests are sent to hosts[active]
+	hosts     []string
+	active    int
+	healthy   map[string]bool
+	hostsLock sync.RWMutex
+	// Credentials in use and the session token obtained with them. Every call builds its own aci-go-client client from them,
+	// so that the token is replaced without modifying the clients of the calls in flight
+	credentials       Credentials
+	credentialsSource CredentialsSource
+	session           session
+	clientLock        sync.RWMutex
+	// Transport shared by all the clients (failover, TLS and session handling)
+	transport   http.RoundTripper
+	sessionLock sync.Mutex
+	// Result of the last login, reported by the readiness check
+	sessionErr     error
+	sessionErrLock sync.RWMutex
+	// TLS settings and the HTTP transport per APIC built from them
+	tlsConfig  TLSConfig
+	caBundle   []byte
+	transports map[string]*http.Transport
+	tlsLock    sync.RWMutex
 }
 
 type ApicInterface interface {
@@ -35,6 +67,8 @@ type ApicInterface interface {
 	DeleteContract(tenantName, name string) error
 	InheritContractFromMaster(epgName, appName, tenantName, appMasterName, epgMasterName string) error
 	EpgExists(name, appName, tenantName string) (bool, error)
+	GetEpgSettings(name, appName, tenantName string) (EpgSettings, error)
+	GetEpgDomains(name, appName, tenantName string) (string, []string, error)
 	AddTagAnnotationToEpg(name, appName, tenantName, key, value string) error
 	RemoveTagAnnotation(name, appName, tenantName, key string) error
 	GetEpgWithAnnotation(appName, tenantName, key string) ([]string, error)
@@ -48,29 +82,154 @@ type ApicInterface interface {
 	GetContractFilters(contractName, tenantName string) ([]string, error)
 	DeleteFilterFromSubjectContract(subjectName, tenantName, filter string) error
 	GetContracts(epgName, appName, tenantName string) (map[string][]string, error)
+	GetTaggedObjects(tenantName string) (map[string]map[string]string, error)
+	GetManagedContracts(tenantName string) ([]string, error)
+	GetObject(dn string) (map[string]string, error)
+	PostTenantConfig(tenantMo *ManagedObject) error
+}
+
+// Create an APIC client authenticated with either password or private key (signature based). The same session is shared by all the reconciles.
+// Requests are sent to one APIC of the cluster and moved to the next one if the APIC is not reachable.
+// Without hosts the client does not login and its requests fail until the hosts are set with SetHosts. The client is also returned if the login fails
+func NewApicClient(hosts []string, credentials CredentialsSource, tlsConfig TLSConfig) (*ApicClient, error) {
+	ac := &ApicClient{apicState: &apicState{
+		hosts:             hosts,
+		healthy:           map[string]bool{},
+		credentialsSource: credentials,
+		tlsConfig:         tlsConfig,
+	}}
+	if _, err := ac.loadCABundle(context.Background()); err != nil {
+		return nil, err
+	}
+	// Assume all the APICs are reachable until the first health check
+	for _, host := range hosts {
+		ac.healthy[host] = true
+	}
+	ac.transport = &metricsTransport{
+		base: &sessionTransport{
+			base: &failoverTransport{ac: ac},
+			ac:   ac,
+		},
+	}
+	// Without hosts the credentials may not be known yet, they are read by SetHosts
+	if len(hosts) == 0 {
+		return ac, nil
+	}
+	if err := ac.readCredentials(context.Background()); err != nil {
+		return nil, err
+	}
+	return ac, ac.login("login")
+}
+
+// Replace the credentials with the ones of the source, without login
+func (ac *ApicClient) readCredentials(ctx context.Context) error {
+	creds, err := ac.credentialsSource(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to read the APIC credentials: %w", err)
+	}
+	if err := creds.validate(); err != nil {
+		return err
+	}
+	ac.clientLock.Lock()
+	defer ac.clientLock.Unlock()
+	ac.credentials = creds
+	return nil
 }
 
-func NewApicClient(host, user, password, privateKey string) (*ApicClient, error) {
-	if privateKey == "" {
-		ac := &ApicClient{
-			host:     host,
-			user:     user,
-			password: password,
-			client:   client.GetClient(fmt.Sprintf("https://%s/", host), user, client.Password(password), client.Insecure(true), client.SkipLoggingPayload(true)),
-		}
-		return ac, ac.client.Authenticate()
-	} else {
-		ac := &ApicClient{
-			host:     host,
-			user:     user,
-			password: password,
-			client:   client.GetClient(fmt.Sprintf("https://%s/", host), user, client.PrivateKey(privateKey), client.AdminCert(fmt.Sprintf("%s.crt", user)), client.Insecure(true), client.SkipLoggingPayload(true)),
-		}
-		// Test the client
-		_, err := ac.client.ListSystem()
-		return ac, err
+// Replace the APICs of the cluster and login to the new cluster with the current credentials of the source
+func (ac *ApicClient) SetHosts(hosts []string) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("no APIC hosts defined")
+	}
+	if err := ac.readCredentials(context.Background()); err != nil {
+		return err
+	}
+	if err := ac.setHostsTransports(hosts); err != nil {
+		return err
+	}
+	ac.hostsLock.Lock()
+	for _, host := range ac.hosts {
+		apicActiveController.DeleteLabelValues(host)
+		apicControllerUp.DeleteLabelValues(host)
+	}
+	ac.hosts, ac.active, ac.healthy = hosts, 0, map[string]bool{}
+	for _, host := range hosts {
+		ac.healthy[host] = true
+	}
+	ac.updateHostMetrics()
+	ac.hostsLock.Unlock()
+
+	ac.sessionLock.Lock()
+	defer ac.sessionLock.Unlock()
+	return ac.login("login")
+}
+
+// Build an aci-go-client client for the credentials and session token. All the clients share the same transport (failover, TLS and
+// session handling). The host of the base URL is replaced by the active APIC on every request
+func (ac *ApicClient) newClient(creds Credentials, token string) *client.Client {
+	baseURL := fmt.Sprintf("https://%s/", apicPlaceholderHost)
+	transport := ac.transport
+	if ac.status != nil {
+		transport = ac.status
+	}
+	httpClient := client.HttpClient(&http.Client{Transport: transport})
+	if creds.Password == "" {
+		return client.NewClient(baseURL, creds.Username, client.PrivateKey(creds.PrivateKey), client.AdminCert(creds.certName()), httpClient, client.SkipLoggingPayload(true))
 	}
-	// TODO: Re-use connection
+	c := client.NewClient(baseURL, creds.Username, client.Password(creds.Password), httpClient, client.SkipLoggingPayload(true))
+	if token != "" {
+		// Expired tokens are rejected by the APIC and renewed by the sessionTransport, not by the client
+		c.AuthToken = &client.Auth{Token: token, Expiry: time.Now().Add(sessionClientLifetime)}
+	}
+	return c
+}
+
+// Client of the current credentials and session token, used by a single call
+func (ac *ApicClient) apic() *client.Client {
+	ac.clientLock.RLock()
+	defer ac.clientLock.RUnlock()
+	return ac.newClient(ac.credentials, ac.session.token)
+}
+
+// Client bound to a single call, recording the HTTP status of its requests. It shares the credentials and session of the client
+func (ac *ApicClient) withStatus() (ApicInterface, *statusRecorder) {
+	status := &statusRecorder{base: ac.transport}
+	return &ApicClient{apicState: ac.apicState, status: status}, status
+}
+
+// Whether the current credentials use password (session token) authentication
+func (ac *ApicClient) usesPassword() bool {
+	ac.clientLock.RLock()
+	defer ac.clientLock.RUnlock()
+	return ac.credentials.Password != ""
+}
+
+/*
+	Bulk configuration function
+*/
+// Post the tenant MO and all its children in one request. The APIC applies the whole request as a single transaction
+func (ac *ApicClient) PostTenantConfig(tenantMo *ManagedObject) error {
+	payload, err := json.Marshal(tenantMo)
+	if err != nil {
+		return err
+	}
+	jsonPayload, err := container.ParseJSON(payload)
+	if err != nil {
+		return err
+	}
+	apic := ac.apic()
+	req, err := apic.MakeRestRequest("POST", fmt.Sprintf("/api/node/mo/%s.json", tenantMo.Attributes["dn"]), jsonPayload, true)
+	if err != nil {
+		return err
+	}
+	cont, resp, err := apic.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := client.CheckForErrors(cont, "POST", true); err != nil {
+		return &StatusError{Code: resp.StatusCode, Err: err}
+	}
+	return nil
 }
 
 /*
@@ -79,7 +238,7 @@ func NewApicClient(host, user, password, privateKey string) (*ApicClient, error)
 func (ac *ApicClient) CreateTenant(name, description string) error {
 	fvTenantAttr := models.TenantAttributes{}
 	fvTenant := models.NewTenant(fmt.Sprintf("tn-%s", name), "uni", description, fvTenantAttr)
-	err := ac.client.Save(fvTenant)
+	err := ac.apic().Save(fvTenant)
 	if err != nil {
 		return err
 	}
@@ -87,7 +246,7 @@ func (ac *ApicClient) CreateTenant(name, description string) error {
 }
 
 func (ac *ApicClient) DeleteTenant(name string) error {
-	err := ac.client.DeleteTenant(name)
+	err := ac.apic().DeleteTenant(name)
 	if err != nil {
 		return err
 	}
@@ -101,7 +260,7 @@ func (ac *ApicClient) CreateApplicationProfile(name, description, tenantName str
 	fvAppAttr := models.ApplicationProfileAttributes{}
 	fvAppAttr.Annotation = "orchestrator:kubernetes"
 	fvApp := models.NewApplicationProfile(fmt.Sprintf("ap-%s", name), fmt.Sprintf("uni/tn-%s", tenantName), description, fvAppAttr)
-	err := ac.client.Save(fvApp)
+	err := ac.apic().Save(fvApp)
 	if err != nil {
 		return err
 	}
@@ -112,7 +271,7 @@ func (ac *ApicClient) CreateApplicationProfile(name, description, tenantName str
 }
 
 func (ac *ApicClient) DeleteApplicationProfile(name, tenantName string) error {
-	err := ac.client.DeleteApplicationProfile(name, tenantName)
+	err := ac.apic().DeleteApplicationProfile(name, tenantName)
 	if err != nil {
 		return err
 	}
@@ -120,9 +279,9 @@ func (ac *ApicClient) DeleteApplicationProfile(name, tenantName string) error {
 }
 
 func (ac *ApicClient) EmptyApplicationProfile(name, tenantName string) (bool, error) {
-	epgList, err := ac.client.ListApplicationEPG(name, tenantName)
+	epgList, err := ac.apic().ListApplicationEPG(name, tenantName)
 	if err != nil {
-		if err.Error() == "Error retrieving Object: Object may not exists" {
+		if isEmptyResponse(err) {
 			return true, nil
 		}
 		return false, err
@@ -133,7 +292,7 @@ func (ac *ApicClient) EmptyApplicationProfile(name, tenantName string) (bool, er
 
 func (ac *ApicClient) ApplicationProfileExists(name, tenantName string) (bool, error) {
 
-	fvAppCont, err := ac.client.Get(fmt.Sprintf("uni/tn-%s/ap-%s", tenantName, name))
+	fvAppCont, err := ac.apic().Get(fmt.Sprintf("uni/tn-%s/ap-%s", tenantName, name))
 	if err != nil {
 		// TODO: Check when it is an real error
 		return false, err
@@ -156,21 +315,21 @@ func (ac *ApicClient) CreateEndpointGroup(name, description, appName, tenantName
 	fvAEpgAttr.Annotation = "orchestrator:kubernetes"
 	fvAEpg := models.NewApplicationEPG(fmt.Sprintf("epg-%s", name), fmt.Sprintf("uni/tn-%s/ap-%s", tenantName, appName), description, fvAEpgAttr)
 
-	if err := ac.client.Save(fvAEpg); err != nil {
+	if err := ac.apic().Save(fvAEpg); err != nil {
 		return err
 	}
-	if err := ac.client.CreateRelationfvRsBdFromApplicationEPG(fvAEpg.DistinguishedName, bdName); err != nil {
+	if err := ac.apic().CreateRelationfvRsBdFromApplicationEPG(fvAEpg.DistinguishedName, bdName); err != nil {
 		return err
 	}
 	tDn := fmt.Sprintf("uni/vmmp-Kubernetes/dom-%s", vmmName)
-	if err := ac.client.CreateRelationfvRsDomAttFromApplicationEPG(fvAEpg.DistinguishedName, tDn); err != nil {
+	if err := ac.apic().CreateRelationfvRsDomAttFromApplicationEPG(fvAEpg.DistinguishedName, tDn); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (ac *ApicClient) DeleteEndpointGroup(name, appName, tenantName string) error {
-	err := ac.client.DeleteApplicationEPG(name, appName, tenantName)
+	err := ac.apic().DeleteApplicationEPG(name, appName, tenantName)
 	if err != nil {
 		return err
 	}
@@ -179,9 +338,11 @@ func (ac *ApicClient) DeleteEndpointGroup(name, appName, tenantName string) erro
 
 func (ac *ApicClient) EpgExists(name, appName, tenantName string) (bool, error) {
 
-	fvAEPgCont, err := ac.client.Get(fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name))
+	fvAEPgCont, err := ac.apic().Get(fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name))
 	if err != nil {
-		// TODO: Check when is an actual error
+		if isEmptyResponse(err) {
+			return false, nil
+		}
 		return false, err
 	}
 	fvAEPg := models.ApplicationEPGFromContainer(fvAEPgCont)
@@ -193,6 +354,54 @@ func (ac *ApicClient) EpgExists(name, appName, tenantName string) (bool, error)
 	return true, nil
 }
 
+// Read the settings of the EPG. EPGs which do not exist have the default settings
+func (ac *ApicClient) GetEpgSettings(name, appName, tenantName string) (EpgSettings, error) {
+
+	fvAEPgCont, err := ac.apic().Get(fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name))
+	if err != nil {
+		if isEmptyResponse(err) {
+			return EpgSettings{}, nil
+		}
+		return EpgSettings{}, err
+	}
+	fvAEPg := models.ApplicationEPGFromContainer(fvAEPgCont)
+	return EpgSettingsFromAttributes(map[string]string{
+		"pcEnfPref":    fvAEPg.PcEnfPref,
+		"prefGrMemb":   fvAEPg.PrefGrMemb,
+		"floodOnEncap": fvAEPg.FloodOnEncap,
+	}), nil
+}
+
+// Read the Bridge Domain (fvRsBd) and the VMM domains (fvRsDomAtt) the EPG is attached to on the APIC
+func (ac *ApicClient) GetEpgDomains(name, appName, tenantName string) (string, []string, error) {
+
+	params := url.Values{}
+	params.Set("query-target", "children")
+	params.Set("target-subtree-class", fmt.Sprintf("fvRsBd,%s", models.FvrsdomattClassName))
+	cont, err := ac.apic().GetViaURL(fmt.Sprintf("/api/node/mo/uni/tn-%s/ap-%s/epg-%s.json?%s", tenantName, appName, name, params.Encode()))
+	if err != nil {
+		if isEmptyResponse(err) {
+			return "", []string{}, nil
+		}
+		return "", []string{}, err
+	}
+	// Both classes are returned in the same list, as {"<class>": {"attributes": {...}}}
+	bd, vmms := "", []string{}
+	relations, _ := cont.S("imdata").Children()
+	for _, rs := range relations {
+		if rs.Exists("fvRsBd") {
+			bd = models.StripQuotes(rs.S("fvRsBd", "attributes", "tnFvBDName").String())
+		}
+		if rs.Exists(models.FvrsdomattClassName) {
+			tDn := models.StripQuotes(rs.S(models.FvrsdomattClassName, "attributes", "tDn").String())
+			if match := vmmDomainRegex.FindStringSubmatch(tDn); match != nil {
+				vmms = append(vmms, match[1])
+			}
+		}
+	}
+	return bd, vmms, nil
+}
+
 // Add Annotation (key=value) to the EPG object
 func (ac *ApicClient) AddTagAnnotationToEpg(name, appName, tenantName, key, value string) error {
 
@@ -206,7 +415,7 @@ func (ac *ApicClient) AddTagAnnotationToEpg(name, appName, tenantName, key, valu
 // Remove Annotation (key=value) to the EPG object
 func (ac *ApicClient) RemoveTagAnnotation(name, appName, tenantName, key string) error {
 	parentDn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name)
-	if err := ac.client.DeleteAnnotation(key, parentDn); err != nil {
+	if err := ac.apic().DeleteAnnotation(key, parentDn); err != nil {
 		return err
 	}
 	return nil
@@ -215,34 +424,33 @@ func (ac *ApicClient) RemoveTagAnnotation(name, appName, tenantName, key string)
 // Get list of EPG with an annotation with specific key
 func (ac *ApicClient) GetEpgWithAnnotation(appName, tenantName, key string) ([]string, error) {
 
-	epgs := []string{}
-	epgList, err := ac.client.ListApplicationEPG(appName, tenantName)
+	appDn := fmt.Sprintf("uni/tn-%s/ap-%s", tenantName, appName)
+	annotationList, err := ac.listAnnotations(appDn, "subtree", fmt.Sprintf(`eq(tagAnnotation.key,"%s")`, key))
 	if err != nil {
 		return []string{}, err
 	}
 
-	for _, epg := range epgList {
-		_, err := ac.client.ReadAnnotation(key, epg.DistinguishedName)
-		if err == nil {
-			epgs = append(epgs, epg.Name)
+	epgs := []string{}
+	for _, ann := range annotationList {
+		if match := epgAnnotationRegex.FindStringSubmatch(ann.DistinguishedName); match != nil && match[1] == tenantName && match[2] == appName {
+			epgs = append(epgs, match[3])
 		}
 	}
-
 	return epgs, nil
 }
 
+// Get the keys of the annotations configured on the EPG
 func (ac *ApicClient) GetAnnotationsEpg(name, appName, tenantName string) ([]string, error) {
-	r, _ := regexp.Compile(fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s/", tenantName, appName, name))
-	annotations := []string{}
-	annotationList, err := ac.client.ListAnnotation()
+
+	epgDn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name)
+	annotationList, err := ac.listAnnotations(epgDn, "children", "")
 	if err != nil {
 		return []string{}, err
 	}
 
+	annotations := []string{}
 	for _, ann := range annotationList {
-		if r.Match([]byte(ann.DistinguishedName)) {
-			annotations = append(annotations, ann.Key)
-		}
+		annotations = append(annotations, ann.Key)
 	}
 	return annotations, nil
 }
@@ -257,7 +465,7 @@ func (ac *ApicClient) ConsumeContract(epgName, appName, tenantName, conName stri
 	epgDn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, epgName)
 
 	fvRsCons := models.NewContractConsumer(fmt.Sprintf("rscons-%s", conName), epgDn, fvRsConsAtt)
-	err := ac.client.Save(fvRsCons)
+	err := ac.apic().Save(fvRsCons)
 	if err != nil {
 		return err
 	}
@@ -275,30 +483,69 @@ func (ac *ApicClient) ProvideContract(epgName, appName, tenantName, conName stri
 	epgDn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, epgName)
 
 	fvRsCons := models.NewContractProvider(fmt.Sprintf("rsprov-%s", conName), epgDn, fvRsProvAtt)
-	err := ac.client.Save(fvRsCons)
+	err := ac.apic().Save(fvRsCons)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Get the contracts related to an EPG. The returned map holds the contracts "provided", "consumed" and "taboo" (by name),
+// and the master EPGs the contracts are "inherited" from (as <application profile>/<epg>)
 func (ac *ApicClient) GetContracts(epgName, appName, tenantName string) (map[string][]string, error) {
-	return map[string][]string{}, nil
+	epgDn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, epgName)
+	contracts := map[string][]string{"provided": {}, "consumed": {}, "taboo": {}, "inherited": {}}
+
+	consumers, err := ac.apic().ListContractConsumer(epgName, appName, tenantName)
+	if err != nil && !isEmptyResponse(err) {
+		return map[string][]string{}, err
+	}
+	for _, con := range consumers {
+		contracts["consumed"] = append(contracts["consumed"], con.TnVzBrCPName)
+	}
+
+	providers, err := ac.apic().ListContractProvider(epgName, appName, tenantName)
+	if err != nil && !isEmptyResponse(err) {
+		return map[string][]string{}, err
+	}
+	for _, prov := range providers {
+		contracts["provided"] = append(contracts["provided"], prov.TnVzBrCPName)
+	}
+
+	taboos, err := ac.apic().ReadRelationfvRsProtByFromApplicationEPG(epgDn)
+	if err != nil && !isEmptyResponse(err) {
+		return map[string][]string{}, err
+	}
+	for _, tDn := range utils.ToStringList(taboos.(*schema.Set).List()) {
+		contracts["taboo"] = append(contracts["taboo"], strings.TrimPrefix(tDn, fmt.Sprintf("uni/tn-%s/taboo-", tenantName)))
+	}
+
+	masters, err := ac.apic().ReadRelationfvRsSecInheritedFromApplicationEPG(epgDn)
+	if err != nil && !isEmptyResponse(err) {
+		return map[string][]string{}, err
+	}
+	for _, tDn := range utils.ToStringList(masters.(*schema.Set).List()) {
+		if match := masterEpgRegex.FindStringSubmatch(tDn); match != nil {
+			contracts["inherited"] = append(contracts["inherited"], fmt.Sprintf("%s/%s", match[1], match[2]))
+		}
+	}
+
+	return contracts, nil
 }
 
 func (ac *ApicClient) DeleteContractConsumer(epgName, appName, tenantName, conName string) error {
-	return ac.client.DeleteContractConsumer(conName, epgName, appName, tenantName)
+	return ac.apic().DeleteContractConsumer(conName, epgName, appName, tenantName)
 }
 
 func (ac *ApicClient) DeleteContractProvider(epgName, appName, tenantName, conName string) error {
-	return ac.client.DeleteContractProvider(conName, epgName, appName, tenantName)
+	return ac.apic().DeleteContractProvider(conName, epgName, appName, tenantName)
 }
 
 func (ac *ApicClient) InheritContractFromMaster(epgName, appName, tenantName, appMasterName, epgMasterName string) error {
 
 	epgDn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, epgName)
 	tDn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appMasterName, epgMasterName)
-	if err := ac.client.CreateRelationfvRsSecInheritedFromApplicationEPG(epgDn, tDn); err != nil {
+	if err := ac.apic().CreateRelationfvRsSecInheritedFromApplicationEPG(epgDn, tDn); err != nil {
 		return err
 	}
 	return nil
@@ -317,17 +564,17 @@ func (ac *ApicClient) CreateContract(tenantName, name string, filters []string)
 	vzSubjAttr.RevFltPorts = "yes"
 
 	vzBrCP := models.NewContract(fmt.Sprintf("brc-%s", name), fmt.Sprintf("uni/tn-%s", tenantName), "", vzBrCPAttr)
-	err := ac.client.Save(vzBrCP)
+	err := ac.apic().Save(vzBrCP)
 	if err != nil {
 		return err
 	}
 	vzSubj := models.NewContractSubject(fmt.Sprintf("subj-%s", name), vzBrCP.DistinguishedName, "", vzSubjAttr)
-	err = ac.client.Save(vzSubj)
+	err = ac.apic().Save(vzSubj)
 	if err != nil {
 		return err
 	}
 	for _, flt := range filters {
-		err = ac.client.CreateRelationvzRsSubjFiltAttFromContractSubject(vzSubj.DistinguishedName, flt)
+		err = ac.apic().CreateRelationvzRsSubjFiltAttFromContractSubject(vzSubj.DistinguishedName, flt)
 		if err != nil {
 			return err
 		}
@@ -338,14 +585,16 @@ func (ac *ApicClient) CreateContract(tenantName, name string, filters []string)
 func (ac *ApicClient) GetContractFilters(contractName, tenantName string) ([]string, error) {
 	dn := fmt.Sprintf("uni/tn-%s/brc-%s/subj-%s", tenantName, contractName, contractName)
 
-	filters, err := ac.client.ReadRelationvzRsSubjFiltAttFromContractSubject(dn)
+	filters, err := ac.apic().ReadRelationvzRsSubjFiltAttFromContractSubject(dn)
 	if err != nil {
+		if isEmptyResponse(err) {
+			return []string{}, nil
+		}
 		return []string{}, err
 	}
 	filtersName := []string{}
 	for _, flt := range utils.ToStringList(filters.(*schema.Set).List()) {
-		r, _ := regexp.Compile("/flt-[a-zA-Z0-9_]*")
-		fltName := r.FindString(flt)
+		fltName := subjectFilterRegex.FindString(flt)
 		filtersName = append(filtersName, strings.Replace(fltName, "/flt-", "", -1))
 	}
 
@@ -354,11 +603,11 @@ func (ac *ApicClient) GetContractFilters(contractName, tenantName string) ([]str
 
 func (ac *ApicClient) DeleteFilterFromSubjectContract(subjectName, tenantName, filter string) error {
 	dn := fmt.Sprintf("uni/tn-%s/brc-%s/subj-%s", tenantName, subjectName, subjectName)
-	return ac.client.DeleteRelationvzRsSubjFiltAttFromContractSubject(dn, filter)
+	return ac.apic().DeleteRelationvzRsSubjFiltAttFromContractSubject(dn, filter)
 }
 
 func (ac *ApicClient) DeleteContract(tenantName, name string) error {
-	err := ac.client.DeleteContract(name, tenantName)
+	err := ac.apic().DeleteContract(name, tenantName)
 	if err != nil {
 		return err
 	}
@@ -377,12 +626,12 @@ func (ac *ApicClient) CreateFilterAndFilterEntry(tenantName, name, eth, ip strin
 	vzEntryAttr.DToPort = strconv.Itoa(port)
 
 	fvFilter := models.NewFilter(fmt.Sprintf("flt-%s", name), fmt.Sprintf("uni/tn-%s", tenantName), "", vzFilterAttr)
-	err := ac.client.Save(fvFilter)
+	err := ac.apic().Save(fvFilter)
 	if err != nil {
 		return err
 	}
 	fvFilterEntry := models.NewFilterEntry(fmt.Sprintf("e-%s", name), fvFilter.DistinguishedName, "", vzEntryAttr)
-	err = ac.client.Save(fvFilterEntry)
+	err = ac.apic().Save(fvFilterEntry)
 	if err != nil {
 		return err
 	}
@@ -390,16 +639,33 @@ func (ac *ApicClient) CreateFilterAndFilterEntry(tenantName, name, eth, ip strin
 }
 
 func (ac *ApicClient) DeleteFilter(tenantName, name string) error {
-	err := ac.client.DeleteFilter(name, tenantName)
+	err := ac.apic().DeleteFilter(name, tenantName)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+var (
+	// DN of the Kubernetes VMM domains
+	vmmDomainRegex = regexp.MustCompile(`^uni/vmmp-Kubernetes/dom-(.+)$`)
+	// DN of the master EPGs the contracts are inherited from
+	masterEpgRegex = regexp.MustCompile(`/ap-([^/]*)/epg-(.*)$`)
+	// DN of the filters attached to a contract subject
+	subjectFilterRegex = regexp.MustCompile(`/flt-[a-zA-Z0-9_]*`)
+	// DN of the annotations of the EPGs and of the filters
+	epgAnnotationRegex    = regexp.MustCompile(`^uni/tn-([^/]*)/ap-([^/]*)/epg-([^/]*)/annotationKey-`)
+	filterAnnotationRegex = regexp.MustCompile(`^uni/tn-([^/]*)/flt-([^/]*)/annotationKey-`)
+)
+
+// The APIC answers class queries without results with an empty response, which the client reports as an error
+func isEmptyResponse(err error) bool {
+	return err.Error() == "Error retrieving Object: Object may not exists"
+}
+
 func (ac *ApicClient) AddTagAnnotation(key, value, parentDn string) error {
 	tag := models.NewAnnotation(fmt.Sprintf("annotationKey-[%s]", key), parentDn, models.AnnotationAttributes{Key: key, Value: value})
-	err := ac.client.Save(tag)
+	err := ac.apic().Save(tag)
 	if err != nil {
 		return err
 	}
@@ -407,10 +673,12 @@ func (ac *ApicClient) AddTagAnnotation(key, value, parentDn string) error {
 }
 
 func (ac *ApicClient) FilterExists(name, tenantName string) (bool, error) {
-	fvFilterCont, err := ac.client.Get(fmt.Sprintf("uni/tn-%s/flt-%s", tenantName, name))
+	fvFilterCont, err := ac.apic().Get(fmt.Sprintf("uni/tn-%s/flt-%s", tenantName, name))
 	if err != nil {
-		// TODO: Check when is an actual error
-		return false, nil
+		if isEmptyResponse(err) {
+			return false, nil
+		}
+		return false, err
 	}
 	fvFilter := models.FilterFromContainer(fvFilterCont)
 
@@ -434,18 +702,106 @@ func (ac *ApicClient) AddTagAnnotationToFilter(name, tenantName, key, value stri
 // Get list of Filters with an annotation with specific key
 func (ac *ApicClient) GetFilterWithAnnotation(tenantName, key string) ([]string, error) {
 
+	tenantDn := fmt.Sprintf("uni/tn-%s", tenantName)
+	annotationList, err := ac.listAnnotations(tenantDn, "subtree", fmt.Sprintf(`and(eq(tagAnnotation.key,"%s"),wcard(tagAnnotation.dn,"/flt-"))`, key))
+	if err != nil {
+		return []string{}, err
+	}
+
 	filters := []string{}
-	filterList, err := ac.client.ListFilter(tenantName)
+	for _, ann := range annotationList {
+		if match := filterAnnotationRegex.FindStringSubmatch(ann.DistinguishedName); match != nil && match[1] == tenantName {
+			filters = append(filters, match[2])
+		}
+	}
+	return filters, nil
+}
+
+// Get the tag annotations (key and value) of all the objects of the tenant, by DN of the tagged object
+func (ac *ApicClient) GetTaggedObjects(tenantName string) (map[string]map[string]string, error) {
+
+	annotationList, err := ac.listAnnotations(fmt.Sprintf("uni/tn-%s", tenantName), "subtree", "")
+	if err != nil {
+		return map[string]map[string]string{}, err
+	}
+
+	objects := map[string]map[string]string{}
+	for _, ann := range annotationList {
+		idx := strings.LastIndex(ann.DistinguishedName, "/annotationKey-")
+		if idx < 0 {
+			continue
+		}
+		dn := ann.DistinguishedName[:idx]
+		if objects[dn] == nil {
+			objects[dn] = map[string]string{}
+		}
+		objects[dn][ann.Key] = ann.Value
+	}
+	return objects, nil
+}
+
+// Get the names of the contracts of the tenant created by the operator (annotated with orchestrator:kubernetes)
+func (ac *ApicClient) GetManagedContracts(tenantName string) ([]string, error) {
+
+	params := url.Values{}
+	params.Set("query-target", "children")
+	params.Set("target-subtree-class", models.VzbrcpClassName)
+	params.Set("query-target-filter", `eq(vzBrCP.annotation,"orchestrator:kubernetes")`)
+	cont, err := ac.apic().GetViaURL(fmt.Sprintf("/api/node/mo/uni/tn-%s.json?%s", tenantName, params.Encode()))
 	if err != nil {
+		if isEmptyResponse(err) {
+			return []string{}, nil
+		}
 		return []string{}, err
 	}
+	contracts := []string{}
+	for _, contract := range models.ContractListFromContainer(cont) {
+		contracts = append(contracts, contract.Name)
+	}
+	return contracts, nil
+}
 
-	for _, flt := range filterList {
-		_, err := ac.client.ReadAnnotation(key, flt.DistinguishedName)
-		if err == nil {
-			filters = append(filters, flt.Name)
+// Read the attributes of the object. Nil if the object does not exist
+func (ac *ApicClient) GetObject(dn string) (map[string]string, error) {
+	cont, err := ac.apic().GetViaURL(fmt.Sprintf("/api/node/mo/%s.json", dn))
+	if err != nil {
+		if isEmptyResponse(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// The object is returned as {"<class>": {"attributes": {...}}}
+	classes, err := cont.S("imdata").Index(0).ChildrenMap()
+	if err != nil {
+		return nil, nil
+	}
+	for _, mo := range classes {
+		attributes := map[string]string{}
+		values, _ := mo.S("attributes").ChildrenMap()
+		for key, value := range values {
+			attributes[key] = models.StripQuotes(value.String())
 		}
+		return attributes, nil
 	}
+	return nil, nil
+}
 
-	return filters, nil
+// Query the tagAnnotation objects below the parentDn in a single request. The scope is defined by queryTarget (children/subtree)
+// and the results can be narrowed down on the APIC with a query-target-filter expression
+func (ac *ApicClient) listAnnotations(parentDn, queryTarget, filter string) ([]*models.Annotation, error) {
+
+	params := url.Values{}
+	params.Set("query-target", queryTarget)
+	params.Set("target-subtree-class", models.TagAnnotationClassName)
+	if filter != "" {
+		params.Set("query-target-filter", filter)
+	}
+	cont, err := ac.apic().GetViaURL(fmt.Sprintf("/api/node/mo/%s.json?%s", parentDn, params.Encode()))
+	if err != nil {
+		if isEmptyResponse(err) {
+			return []*models.Annotation{}, nil
+		}
+		return []*models.Annotation{}, err
+	}
+	return models.AnnotationListFromContainer(cont), nil
 }
@@ -1,18 +1,24 @@
 package aci
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/jgomezve/aci-k8s-operator/pkg/utils"
 )
 
 type applicationProfile struct {
-	name string
-	tnt  string
+	name  string
+	tnt   string
+	descr string
 }
 
 type endpointGroup struct {
 	name      string
+	descr     string
 	tnt       string
 	app       string
 	Bd        string
@@ -20,26 +26,33 @@ type endpointGroup struct {
 	tags      map[string]string
 	contracts map[string][]string
 	// Only one master
-	Master []string
+	Master   []string
+	settings EpgSettings
 }
 
 type contract struct {
 	name    string
 	tnt     string
 	filters []string
+	tags    map[string]string
 }
 
 type filter struct {
 	name string
 	tnt  string
 	tags map[string]string
+	// Attributes of the filter entry
+	entry map[string]string
 }
 
 type ApicClientMocks struct {
+	hosts               []string
 	filters             map[string]filter
 	endpointGroups      map[string]endpointGroup
 	contracts           map[string]contract
 	applicationProfiles map[string]applicationProfile
+	// Error returned by PostTenantConfig, e.g. to simulate an unreachable APIC
+	postErr error
 }
 
 func init() {
@@ -53,6 +66,15 @@ var (
 	ApicMockClient ApicClientMocks
 )
 
+func (ac *ApicClientMocks) SetHosts(hosts []string) error {
+	ac.hosts = hosts
+	return nil
+}
+
+func (ac *ApicClientMocks) ReloadCredentials(_ context.Context) (bool, error) {
+	return false, nil
+}
+
 func (ac *ApicClientMocks) CreateTenant(name, description string) error {
 	fmt.Print("Creating Tenant\n")
 	return nil
@@ -66,7 +88,7 @@ func (ac *ApicClientMocks) DeleteTenant(name string) error {
 func (ac *ApicClientMocks) CreateApplicationProfile(name, description, tenantName string) error {
 	dn := fmt.Sprintf("uni/tn-%s/ap-%s", tenantName, name)
 	fmt.Printf("Creating App %s \n", dn)
-	ac.applicationProfiles[dn] = applicationProfile{name: name, tnt: tenantName}
+	ac.applicationProfiles[dn] = applicationProfile{name: name, tnt: tenantName, descr: description}
 	return nil
 }
 
@@ -97,7 +119,7 @@ func (ac *ApicClientMocks) EmptyApplicationProfile(name, tenantName string) (boo
 func (ac *ApicClientMocks) CreateEndpointGroup(name, description, appName, tenantName, bdName, vmmName string) error {
 	dn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name)
 	fmt.Printf("Creating EPG %s \n", dn)
-	ac.endpointGroups[dn] = endpointGroup{name: name, app: appName, tnt: tenantName, Bd: bdName, Vmm: vmmName, tags: map[string]string{}, contracts: map[string][]string{}, Master: []string{}}
+	ac.endpointGroups[dn] = endpointGroup{name: name, descr: description, app: appName, tnt: tenantName, Bd: bdName, Vmm: vmmName, tags: map[string]string{}, contracts: map[string][]string{}, Master: []string{}}
 	return nil
 }
 
@@ -115,6 +137,20 @@ func (ac *ApicClientMocks) EpgExists(name, appName, tenantName string) (bool, er
 	return exists, nil
 }
 
+func (ac *ApicClientMocks) GetEpgSettings(name, appName, tenantName string) (EpgSettings, error) {
+	dn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name)
+	return ac.endpointGroups[dn].settings, nil
+}
+
+func (ac *ApicClientMocks) GetEpgDomains(name, appName, tenantName string) (string, []string, error) {
+	dn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, name)
+	epg, exists := ac.endpointGroups[dn]
+	if !exists || epg.Vmm == "" {
+		return epg.Bd, []string{}, nil
+	}
+	return epg.Bd, []string{epg.Vmm}, nil
+}
+
 // Contract in the same tenant
 func (ac *ApicClientMocks) ConsumeContract(epgName, appName, tenantName, conName string) error {
 	dn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, epgName)
@@ -137,8 +173,13 @@ func (ac *ApicClientMocks) ProvideContract(epgName, appName, tenantName, conName
 
 func (ac *ApicClientMocks) GetContracts(epgName, appName, tenantName string) (map[string][]string, error) {
 	dn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, epgName)
-	fmt.Printf("Contracts consumed/provided by EPG %s : %s\n", dn, ac.endpointGroups[dn].contracts)
-	return ac.endpointGroups[dn].contracts, nil
+	contracts := map[string][]string{"provided": {}, "consumed": {}, "taboo": {}, "inherited": {}}
+	for k, v := range ac.endpointGroups[dn].contracts {
+		contracts[k] = append(contracts[k], v...)
+	}
+	contracts["inherited"] = append(contracts["inherited"], ac.endpointGroups[dn].Master...)
+	fmt.Printf("Contracts consumed/provided by EPG %s : %s\n", dn, contracts)
+	return contracts, nil
 }
 
 func (ac *ApicClientMocks) DeleteContractConsumer(epgName, appName, tenantName, conName string) error {
@@ -180,7 +221,17 @@ func (ac *ApicClientMocks) RemoveTagAnnotation(name, appName, tenantName, key st
 func (ac *ApicClientMocks) CreateFilterAndFilterEntry(tenantName, name, eth, ip string, port int) error {
 	dn := fmt.Sprintf("uni/tn-%s/flt-%s", tenantName, name)
 	fmt.Printf("Creating Filter %s \n", dn)
-	ac.filters[dn] = filter{name: name, tnt: tenantName, tags: map[string]string{}}
+	entry := map[string]string{"name": name}
+	if eth != "" {
+		entry["etherT"] = eth
+	}
+	if ip != "" {
+		entry["prot"] = ip
+	}
+	if port != 0 {
+		entry["dFromPort"], entry["dToPort"] = strconv.Itoa(port), strconv.Itoa(port)
+	}
+	ac.filters[dn] = filter{name: name, tnt: tenantName, tags: map[string]string{}, entry: entry}
 	return nil
 }
 
@@ -234,15 +285,15 @@ func (ac *ApicClientMocks) CreateContract(tenantName, name string, filters []str
 	_, exists := ac.contracts[dn]
 	// If the contracts exists, then append new filters
 	if !exists {
-		ac.contracts[dn] = contract{name: name, tnt: tenantName, filters: filters}
+		ac.contracts[dn] = contract{name: name, tnt: tenantName, filters: filters, tags: map[string]string{}}
 	} else {
 		fmt.Printf("Contract %s already exists\n", dn)
 		for _, flt := range filters {
 			if !utils.Contains(ac.contracts[dn].filters, flt) {
-				currentFilters := ac.contracts[dn].filters
-				currentFilters = append(currentFilters, flt)
+				con := ac.contracts[dn]
+				con.filters = append(con.filters, flt)
 				fmt.Printf("Adding filter %s to contract %s\n", flt, dn)
-				ac.contracts[dn] = contract{name: name, tnt: tenantName, filters: currentFilters}
+				ac.contracts[dn] = con
 			}
 		}
 	}
@@ -257,8 +308,9 @@ func (ac *ApicClientMocks) GetContractFilters(contractName, tenantName string) (
 func (ac *ApicClientMocks) DeleteFilterFromSubjectContract(subjectName, tenantName, filter string) error {
 	dn := fmt.Sprintf("uni/tn-%s/brp-%s", tenantName, subjectName)
 	fmt.Printf("Deleting filter %s from contract %s\n", filter, subjectName)
-	ftls := ac.contracts[dn].filters
-	ac.contracts[dn] = contract{name: subjectName, tnt: tenantName, filters: utils.Remove(ftls, filter)}
+	con := ac.contracts[dn]
+	con.filters = utils.Remove(con.filters, filter)
+	ac.contracts[dn] = con
 	return nil
 }
 func (ac *ApicClientMocks) DeleteContract(tenantName, name string) error {
@@ -287,3 +339,252 @@ func (ac *ApicClientMocks) GetFilterWithAnnotation(tenantName, key string) ([]st
 	}
 	return filterList, nil
 }
+
+func (ac *ApicClientMocks) GetTaggedObjects(tenantName string) (map[string]map[string]string, error) {
+	fmt.Printf("Getting tagged objects of Tenant %s \n", tenantName)
+	objects := map[string]map[string]string{}
+	for dn, flt := range ac.filters {
+		if flt.tnt == tenantName && len(flt.tags) > 0 {
+			objects[dn] = map[string]string{}
+			for k, v := range flt.tags {
+				objects[dn][k] = v
+			}
+		}
+	}
+	for dn, epg := range ac.endpointGroups {
+		if epg.tnt == tenantName && len(epg.tags) > 0 {
+			objects[dn] = map[string]string{}
+			for k, v := range epg.tags {
+				objects[dn][k] = v
+			}
+		}
+	}
+	for _, con := range ac.contracts {
+		if con.tnt == tenantName && len(con.tags) > 0 {
+			dn := fmt.Sprintf("uni/tn-%s/brc-%s", con.tnt, con.name)
+			objects[dn] = map[string]string{}
+			for k, v := range con.tags {
+				objects[dn][k] = v
+			}
+		}
+	}
+	return objects, nil
+}
+
+func (ac *ApicClientMocks) GetManagedContracts(tenantName string) ([]string, error) {
+	contracts := []string{}
+	for _, con := range ac.contracts {
+		if con.tnt == tenantName {
+			contracts = append(contracts, con.name)
+		}
+	}
+	return contracts, nil
+}
+
+// Read the attributes of an object of the Mock, as the APIC returns them. Tenants always exist
+func (ac *ApicClientMocks) GetObject(dn string) (map[string]string, error) {
+	if match := regexp.MustCompile(`^uni/tn-([^/]*)$`).FindStringSubmatch(dn); match != nil {
+		return map[string]string{"name": match[1]}, nil
+	}
+	return ac.objects()[dn], nil
+}
+
+// Objects of the Mock by DN
+func (ac *ApicClientMocks) objects() map[string]map[string]string {
+	objects := map[string]map[string]string{}
+	for dn, app := range ac.applicationProfiles {
+		objects[dn] = map[string]string{"name": app.name, "descr": app.descr, "annotation": "orchestrator:kubernetes"}
+	}
+	for dn, epg := range ac.endpointGroups {
+		objects[dn] = epg.settings.Attributes()
+		for key, value := range map[string]string{"name": epg.name, "descr": epg.descr, "annotation": "orchestrator:kubernetes"} {
+			objects[dn][key] = value
+		}
+		objects[fmt.Sprintf("%s/rsbd", dn)] = map[string]string{"tnFvBDName": epg.Bd}
+		domDn := fmt.Sprintf("uni/vmmp-Kubernetes/dom-%s", epg.Vmm)
+		objects[fmt.Sprintf("%s/rsdomAtt-[%s]", dn, domDn)] = map[string]string{"tDn": domDn}
+		for key, value := range epg.tags {
+			objects[fmt.Sprintf("%s/annotationKey-[%s]", dn, key)] = map[string]string{"key": key, "value": value}
+		}
+		for _, con := range epg.contracts["consumed"] {
+			objects[fmt.Sprintf("%s/rscons-%s", dn, con)] = map[string]string{"tnVzBrCPName": con}
+		}
+		for _, con := range epg.contracts["provided"] {
+			objects[fmt.Sprintf("%s/rsprov-%s", dn, con)] = map[string]string{"tnVzBrCPName": con}
+		}
+		for _, master := range epg.Master {
+			tDn := fmt.Sprintf("uni/tn-%s/ap-%s", epg.tnt, strings.Replace(master, "/", "/epg-", 1))
+			objects[fmt.Sprintf("%s/rssecInherited-[%s]", dn, tDn)] = map[string]string{"tDn": tDn}
+		}
+	}
+	for dn, flt := range ac.filters {
+		objects[dn] = map[string]string{"name": flt.name, "annotation": "orchestrator:kubernetes"}
+		objects[fmt.Sprintf("%s/e-%s", dn, flt.name)] = flt.entry
+		for key, value := range flt.tags {
+			objects[fmt.Sprintf("%s/annotationKey-[%s]", dn, key)] = map[string]string{"key": key, "value": value}
+		}
+	}
+	for _, con := range ac.contracts {
+		dn := fmt.Sprintf("uni/tn-%s/brc-%s", con.tnt, con.name)
+		objects[dn] = map[string]string{"name": con.name, "annotation": "orchestrator:kubernetes"}
+		objects[fmt.Sprintf("%s/subj-%s", dn, con.name)] = map[string]string{"name": con.name, "revFltPorts": "yes"}
+		for _, flt := range con.filters {
+			objects[fmt.Sprintf("%s/subj-%s/rssubjFiltAtt-%s", dn, con.name, flt)] = map[string]string{"tnVzFilterName": flt}
+		}
+		for key, value := range con.tags {
+			objects[fmt.Sprintf("%s/annotationKey-[%s]", dn, key)] = map[string]string{"key": key, "value": value}
+		}
+	}
+	return objects
+}
+
+// Apply the tenant MO tree by dispatching each MO to the corresponding Mock function
+// Make PostTenantConfig fail with the error. A nil error restores the posts
+func (ac *ApicClientMocks) SetPostTenantConfigError(err error) {
+	ac.postErr = err
+}
+
+func (ac *ApicClientMocks) PostTenantConfig(tenantMo *ManagedObject) error {
+	if ac.postErr != nil {
+		return ac.postErr
+	}
+	tnt := tenantMo.Attributes["name"]
+	fmt.Printf("Posting configuration of Tenant %s\n", tnt)
+	for _, mo := range tenantMo.Children {
+		switch mo.ClassName {
+		case "fvAp":
+			ac.postApplicationProfile(tnt, mo)
+		case "vzFilter":
+			name := mo.Attributes["name"]
+			if mo.IsDeleted() {
+				ac.DeleteFilter(tnt, name)
+				continue
+			}
+			if exists, _ := ac.FilterExists(name, tnt); !exists {
+				eth, ip, port := "", "", 0
+				if entry := mo.GetChild("vzEntry", "name", name); entry != nil {
+					eth, ip = entry.Attributes["etherT"], entry.Attributes["prot"]
+					port, _ = strconv.Atoi(entry.Attributes["dFromPort"])
+				}
+				ac.CreateFilterAndFilterEntry(tnt, name, eth, ip, port)
+			}
+			for _, tag := range mo.Children {
+				if tag.ClassName != "tagAnnotation" {
+					continue
+				}
+				if tag.IsDeleted() {
+					delete(ac.filters[fmt.Sprintf("uni/tn-%s/flt-%s", tnt, name)].tags, tag.Attributes["key"])
+				} else {
+					ac.AddTagAnnotationToFilter(name, tnt, tag.Attributes["key"], tag.Attributes["value"])
+				}
+			}
+		case "vzBrCP":
+			name := mo.Attributes["name"]
+			if mo.IsDeleted() {
+				ac.DeleteContract(tnt, name)
+				continue
+			}
+			filters, subjects := []string{}, 0
+			for _, child := range mo.Children {
+				if child.ClassName == "tagAnnotation" {
+					ac.postContractTag(tnt, name, child)
+					continue
+				}
+				subjects++
+				for _, flt := range child.Children {
+					if flt.IsDeleted() {
+						ac.DeleteFilterFromSubjectContract(name, tnt, flt.Attributes["tnVzFilterName"])
+					} else {
+						filters = append(filters, flt.Attributes["tnVzFilterName"])
+					}
+				}
+			}
+			// Contracts without subject are only used as parents
+			if subjects > 0 {
+				ac.CreateContract(tnt, name, filters)
+			}
+		}
+	}
+	return nil
+}
+
+// Add or remove a tag of an existing contract
+func (ac *ApicClientMocks) postContractTag(tnt, name string, tag *ManagedObject) {
+	dn := fmt.Sprintf("uni/tn-%s/brp-%s", tnt, name)
+	con, exists := ac.contracts[dn]
+	if !exists {
+		return
+	}
+	if tag.IsDeleted() {
+		delete(con.tags, tag.Attributes["key"])
+	} else {
+		con.tags[tag.Attributes["key"]] = tag.Attributes["value"]
+	}
+}
+
+func (ac *ApicClientMocks) postApplicationProfile(tnt string, appMo *ManagedObject) {
+	app := appMo.Attributes["name"]
+	if appMo.IsDeleted() {
+		ac.DeleteApplicationProfile(app, tnt)
+		return
+	}
+	ac.CreateApplicationProfile(app, appMo.Attributes["descr"], tnt)
+	for _, epgMo := range appMo.Children {
+		epg := epgMo.Attributes["name"]
+		if epgMo.IsDeleted() {
+			ac.DeleteEndpointGroup(epg, app, tnt)
+			continue
+		}
+		if exists, _ := ac.EpgExists(epg, app, tnt); !exists {
+			bd, vmm := "", ""
+			for _, child := range epgMo.Children {
+				switch child.ClassName {
+				case "fvRsBd":
+					bd = child.Attributes["tnFvBDName"]
+				case "fvRsDomAtt":
+					vmm = strings.TrimPrefix(child.Attributes["tDn"], "uni/vmmp-Kubernetes/dom-")
+				}
+			}
+			ac.CreateEndpointGroup(epg, epgMo.Attributes["descr"], app, tnt, bd, vmm)
+		}
+		if descr, ok := epgMo.Attributes["descr"]; ok {
+			dn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tnt, app, epg)
+			epgConf := ac.endpointGroups[dn]
+			epgConf.descr = descr
+			ac.endpointGroups[dn] = epgConf
+		}
+		if _, ok := epgMo.Attributes["pcEnfPref"]; ok {
+			dn := fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tnt, app, epg)
+			epgConf := ac.endpointGroups[dn]
+			epgConf.settings = EpgSettingsFromAttributes(epgMo.Attributes)
+			ac.endpointGroups[dn] = epgConf
+		}
+		for _, child := range epgMo.Children {
+			switch child.ClassName {
+			case "tagAnnotation":
+				if child.IsDeleted() {
+					ac.RemoveTagAnnotation(epg, app, tnt, child.Attributes["key"])
+				} else {
+					ac.AddTagAnnotationToEpg(epg, app, tnt, child.Attributes["key"], child.Attributes["value"])
+				}
+			case "fvRsCons":
+				if child.IsDeleted() {
+					ac.DeleteContractConsumer(epg, app, tnt, child.Attributes["tnVzBrCPName"])
+				} else {
+					ac.ConsumeContract(epg, app, tnt, child.Attributes["tnVzBrCPName"])
+				}
+			case "fvRsProv":
+				if child.IsDeleted() {
+					ac.DeleteContractProvider(epg, app, tnt, child.Attributes["tnVzBrCPName"])
+				} else {
+					ac.ProvideContract(epg, app, tnt, child.Attributes["tnVzBrCPName"])
+				}
+			case "fvRsSecInherited":
+				r, _ := regexp.Compile("/ap-([^/]*)/epg-(.*)$")
+				if match := r.FindStringSubmatch(child.Attributes["tDn"]); match != nil {
+					ac.InheritContractFromMaster(epg, app, tnt, match[1], match[2])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package aci
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	apicEmptyResponse        = `{"totalCount":"0","imdata":[]}`
+	apicInvalidTokenResponse = `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"403","text":"Token was invalid (Error: Token timeout)"}}}]}`
+)
+
+// APIC answering logins with a new session token and the other requests with a handler. Requests without a valid token are rejected
+type fakeApic struct {
+	server   *httptest.Server
+	password string
+	handler  http.HandlerFunc
+	lock     sync.Mutex
+	token    string
+	logins   int
+}
+
+func newFakeApic(t *testing.T, password string, handler http.HandlerFunc) *fakeApic {
+	apic := &fakeApic{password: password, handler: handler}
+	apic.server = httptest.NewTLSServer(http.HandlerFunc(apic.serve))
+	t.Cleanup(apic.server.Close)
+	return apic
+}
+
+func (a *fakeApic) serve(w http.ResponseWriter, r *http.Request) {
+	a.lock.Lock()
+	if r.URL.Path == "/api/aaaLogin.json" {
+		defer a.lock.Unlock()
+		login := struct {
+			AaaUser struct {
+				Attributes struct {
+					Pwd string `json:"pwd"`
+				} `json:"attributes"`
+			} `json:"aaaUser"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil || login.AaaUser.Attributes.Pwd != a.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"401","text":"Login failed"}}}]}`)
+			return
+		}
+		a.logins++
+		a.token = fmt.Sprintf("token-%d", a.logins)
+		fmt.Fprintf(w, `{"totalCount":"1","imdata":[{"aaaLogin":{"attributes":{"token":"%s","creationTime":"%d","refreshTimeoutSeconds":"600"}}}]}`, a.token, time.Now().Unix())
+		return
+	}
+	cookie, err := r.Cookie("APIC-Cookie")
+	valid := err == nil && cookie.Value == a.token
+	a.lock.Unlock()
+	if !valid {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, apicInvalidTokenResponse)
+		return
+	}
+	a.handler(w, r)
+}
+
+func (a *fakeApic) host() string {
+	return a.server.Listener.Addr().String()
+}
+
+// PEM encoded certificate of the APIC, valid for example.com
+func (a *fakeApic) caBundle() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.server.Certificate().Raw})
+}
+
+// Invalidate the session token, as the APIC does when it expires
+func (a *fakeApic) expireToken() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.token = ""
+}
+
+func (a *fakeApic) loginCount() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.logins
+}
+
+func staticCABundle(bundle []byte) CABundleSource {
+	return func(_ context.Context) ([]byte, error) {
+		return bundle, nil
+	}
+}
+
+// Client of the fake APICs trusting the certificate of the first one. All the fake APICs share the same certificate
+func newTestApicClient(t *testing.T, credentials CredentialsSource, apics ...*fakeApic) *ApicClient {
+	hosts := []string{}
+	for _, apic := range apics {
+		hosts = append(hosts, apic.host())
+	}
+	ac, err := NewApicClient(hosts, credentials, TLSConfig{ServerName: "example.com", CABundle: staticCABundle(apics[0].caBundle())})
+	if err != nil {
+		t.Fatalf("unable to login to the fake APIC: %s", err)
+	}
+	return ac
+}
+
+func TestNewApicClient(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+	if logins := apic.loginCount(); logins != 1 {
+		t.Errorf("got %d logins, want 1", logins)
+	}
+
+	hosts := []string{apic.host()}
+	_, err := NewApicClient(hosts, StaticCredentials(Credentials{Username: "admin", Password: "wrong"}), TLSConfig{ServerName: "example.com", CABundle: staticCABundle(apic.caBundle())})
+	if err == nil {
+		t.Errorf("expected the login with a wrong password to fail")
+	}
+}
+
+func TestGetObject(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/node/mo/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a.json" {
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"fvAEPg":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a","name":"ns-a","pcEnfPref":"enforced"}}}]}`)
+			return
+		}
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+
+	attributes, err := ac.GetObject("uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]string{"dn": "uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a", "name": "ns-a", "pcEnfPref": "enforced"}
+	if !reflect.DeepEqual(attributes, want) {
+		t.Errorf("got %v, want %v", attributes, want)
+	}
+	if attributes, err := ac.GetObject("uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-b"); err != nil || attributes != nil {
+		t.Errorf("got %v (error %v) for a missing object, want nil", attributes, err)
+	}
+}
+
+func TestObjectExists(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/node/mo/uni/tn-k8s/flt-web.json":
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"vzFilter":{"attributes":{"dn":"uni/tn-k8s/flt-web","name":"web"}}}]}`)
+		case "/api/node/mo/uni/tn-k8s/flt-broken.json", "/api/node/mo/uni/tn-k8s/ap-Seg_Pol_k8s/epg-broken.json":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"400","text":"Request failed"}}}]}`)
+		default:
+			fmt.Fprint(w, apicEmptyResponse)
+		}
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+
+	tests := []struct {
+		name    string
+		exists  func() (bool, error)
+		want    bool
+		wantErr bool
+	}{
+		{"existing filter", func() (bool, error) { return ac.FilterExists("web", "k8s") }, true, false},
+		{"missing filter", func() (bool, error) { return ac.FilterExists("db", "k8s") }, false, false},
+		{"filter read error", func() (bool, error) { return ac.FilterExists("broken", "k8s") }, false, true},
+		{"missing EPG", func() (bool, error) { return ac.EpgExists("ns-a", "Seg_Pol_k8s", "k8s") }, false, false},
+		{"EPG read error", func() (bool, error) { return ac.EpgExists("broken", "Seg_Pol_k8s", "k8s") }, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exists, err := test.exists()
+			if exists != test.want || (err != nil) != test.wantErr {
+				t.Errorf("got %v (error %v), want %v (error %v)", exists, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetEpgDomains(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/node/mo/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a.json" {
+			fmt.Fprint(w, `{"totalCount":"3","imdata":[`+
+				`{"fvRsBd":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rsbd","tnFvBDName":"aci-containers-k8s-pod"}}},`+
+				`{"fvRsDomAtt":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rsdomAtt-[uni/vmmp-Kubernetes/dom-k8s]","tDn":"uni/vmmp-Kubernetes/dom-k8s"}}},`+
+				`{"fvRsDomAtt":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rsdomAtt-[uni/phys-baremetal]","tDn":"uni/phys-baremetal"}}}]}`)
+			return
+		}
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+
+	bd, vmms, err := ac.GetEpgDomains("ns-a", "Seg_Pol_k8s", "k8s")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if bd != "aci-containers-k8s-pod" || !reflect.DeepEqual(vmms, []string{"k8s"}) {
+		t.Errorf("got Bridge Domain %s and VMM domains %v, want aci-containers-k8s-pod and [k8s]", bd, vmms)
+	}
+	if bd, vmms, err := ac.GetEpgDomains("ns-b", "Seg_Pol_k8s", "k8s"); err != nil || bd != "" || len(vmms) != 0 {
+		t.Errorf("got Bridge Domain %q and VMM domains %v (error %v) for a missing EPG, want none", bd, vmms, err)
+	}
+}
+
+// APIC response with the tagAnnotation objects of the DNs, all of them with the same key and value
+func annotationsResponse(key string, dns ...string) string {
+	objects := []string{}
+	for _, dn := range dns {
+		objects = append(objects, fmt.Sprintf(`{"tagAnnotation":{"attributes":{"dn":"%s","key":"%s","value":"%s"}}}`, dn, key, key))
+	}
+	return fmt.Sprintf(`{"totalCount":"%d","imdata":[%s]}`, len(dns), strings.Join(objects, ","))
+}
+
+func TestListAnnotations(t *testing.T) {
+	var lock sync.Mutex
+	var requests []*url.URL
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.URL)
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/api/node/mo/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a.json", "/api/node/mo/uni/tn-k8s.json":
+			fmt.Fprint(w, annotationsResponse("pol", "uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/annotationKey-[pol]"))
+		case "/api/node/mo/uni/tn-broken.json":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"400","text":"Request failed"}}}]}`)
+		default:
+			fmt.Fprint(w, apicEmptyResponse)
+		}
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+
+	tests := []struct {
+		name        string
+		parentDn    string
+		queryTarget string
+		filter      string
+		wantPath    string
+		wantQuery   url.Values
+		wantKeys    []string
+		wantErr     bool
+	}{
+		{
+			name:        "children without filter",
+			parentDn:    "uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a",
+			queryTarget: "children",
+			wantPath:    "/api/node/mo/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a.json",
+			wantQuery:   url.Values{"query-target": {"children"}, "target-subtree-class": {"tagAnnotation"}},
+			wantKeys:    []string{"pol"},
+		},
+		{
+			name:        "subtree with filter",
+			parentDn:    "uni/tn-k8s",
+			queryTarget: "subtree",
+			filter:      `and(eq(tagAnnotation.key,"pol"),wcard(tagAnnotation.dn,"/flt-"))`,
+			wantPath:    "/api/node/mo/uni/tn-k8s.json",
+			wantQuery: url.Values{
+				"query-target":         {"subtree"},
+				"target-subtree-class": {"tagAnnotation"},
+				"query-target-filter":  {`and(eq(tagAnnotation.key,"pol"),wcard(tagAnnotation.dn,"/flt-"))`},
+			},
+			wantKeys: []string{"pol"},
+		},
+		{
+			name:        "no annotations",
+			parentDn:    "uni/tn-empty",
+			queryTarget: "subtree",
+			wantPath:    "/api/node/mo/uni/tn-empty.json",
+			wantQuery:   url.Values{"query-target": {"subtree"}, "target-subtree-class": {"tagAnnotation"}},
+			wantKeys:    []string{},
+		},
+		{
+			name:        "read error",
+			parentDn:    "uni/tn-broken",
+			queryTarget: "subtree",
+			wantPath:    "/api/node/mo/uni/tn-broken.json",
+			wantQuery:   url.Values{"query-target": {"subtree"}, "target-subtree-class": {"tagAnnotation"}},
+			wantKeys:    []string{},
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lock.Lock()
+			requests = nil
+			lock.Unlock()
+			annotations, err := ac.listAnnotations(test.parentDn, test.queryTarget, test.filter)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			keys := []string{}
+			for _, ann := range annotations {
+				keys = append(keys, ann.Key)
+			}
+			if !reflect.DeepEqual(keys, test.wantKeys) {
+				t.Errorf("got annotations %v, want %v", keys, test.wantKeys)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			if requests[0].Path != test.wantPath || !reflect.DeepEqual(requests[0].Query(), test.wantQuery) {
+				t.Errorf("got request %s?%s, want %s?%s", requests[0].Path, requests[0].Query().Encode(), test.wantPath, test.wantQuery.Encode())
+			}
+		})
+	}
+}
+
+func TestGetObjectsWithAnnotation(t *testing.T) {
+	// The fake APIC does not evaluate the query filters, the objects are selected from the DNs of the annotations
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, annotationsResponse("pol",
+			"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/annotationKey-[pol]",
+			"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns.b/annotationKey-[pol]",
+			"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-c/subnet-[10.0.0.1/24]/annotationKey-[pol]",
+			"uni/tn-k8s/ap-Seg_Pol_k8sXother/epg-ns-d/annotationKey-[pol]",
+			"uni/tn-k8s/ap-Other/epg-ns-e/annotationKey-[pol]",
+			"uni/tn-k8s/flt-pol_iptcp80/annotationKey-[pol]",
+			"uni/tn-k8s/flt-pol_iptcp80/e-pol_iptcp80/annotationKey-[pol]",
+			"uni/tn-k8s/brc-pol/annotationKey-[pol]",
+		))
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+
+	tests := []struct {
+		name string
+		get  func() ([]string, error)
+		want []string
+	}{
+		{"EPGs of the Application Profile", func() ([]string, error) { return ac.GetEpgWithAnnotation("Seg_Pol_k8s", "k8s", "pol") }, []string{"ns-a", "ns.b"}},
+		{"EPGs of another Application Profile", func() ([]string, error) { return ac.GetEpgWithAnnotation("Other", "k8s", "pol") }, []string{"ns-e"}},
+		{"Filters of the tenant", func() ([]string, error) { return ac.GetFilterWithAnnotation("k8s", "pol") }, []string{"pol_iptcp80"}},
+		{"Filters of another tenant", func() ([]string, error) { return ac.GetFilterWithAnnotation("other", "pol") }, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names, err := test.get()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("got %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestGetContracts(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/node/class/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/fvRsCons.json":
+			fmt.Fprint(w, `{"totalCount":"2","imdata":[`+
+				`{"fvRsCons":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rscons-pol-a","tnVzBrCPName":"pol-a"}}},`+
+				`{"fvRsCons":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rscons-pol-b","tnVzBrCPName":"pol-b"}}}]}`)
+		case "/api/node/class/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/fvRsProv.json":
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"fvRsProv":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rsprov-pol-a","tnVzBrCPName":"pol-a"}}}]}`)
+		case "/api/node/class/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/fvRsProtBy.json":
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"fvRsProtBy":{"attributes":{"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rsprotBy-deny","tDn":"uni/tn-k8s/taboo-deny"}}}]}`)
+		case "/api/node/class/uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/fvRsSecInherited.json":
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"fvRsSecInherited":{"attributes":{`+
+				`"dn":"uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rssecInherited-[uni/tn-k8s/ap-aci-containers-k8s/epg-aci-containers-default]",`+
+				`"tDn":"uni/tn-k8s/ap-aci-containers-k8s/epg-aci-containers-default"}}}]}`)
+		case "/api/node/class/uni/tn-k8s/ap-Seg_Pol_k8s/epg-broken/fvRsCons.json":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"400","text":"Request failed"}}}]}`)
+		default:
+			fmt.Fprint(w, apicEmptyResponse)
+		}
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+
+	tests := []struct {
+		name    string
+		epg     string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			name: "EPG with relations",
+			epg:  "ns-a",
+			want: map[string][]string{
+				"consumed":  {"pol-a", "pol-b"},
+				"provided":  {"pol-a"},
+				"taboo":     {"deny"},
+				"inherited": {"aci-containers-k8s/aci-containers-default"},
+			},
+		},
+		{
+			name: "EPG without relations",
+			epg:  "ns-b",
+			want: map[string][]string{"consumed": {}, "provided": {}, "taboo": {}, "inherited": {}},
+		},
+		{
+			name:    "read error",
+			epg:     "broken",
+			want:    map[string][]string{},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contracts, err := ac.GetContracts(test.epg, "Seg_Pol_k8s", "k8s")
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(contracts, test.want) {
+				t.Errorf("got %v, want %v", contracts, test.want)
+			}
+		})
+	}
+}
+
+func TestGetContractFilters(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/node/class/uni/tn-k8s/brc-pol/subj-pol/vzRsSubjFiltAtt.json" {
+			fmt.Fprint(w, `{"totalCount":"1","imdata":[{"vzRsSubjFiltAtt":{"attributes":{"dn":"uni/tn-k8s/brc-pol/subj-pol/rssubjFiltAtt-pol_iptcp80","tDn":"uni/tn-k8s/flt-pol_iptcp80"}}}]}`)
+			return
+		}
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+
+	filters, err := ac.GetContractFilters("pol", "k8s")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(filters, []string{"pol_iptcp80"}) {
+		t.Errorf("got %v, want [pol_iptcp80]", filters)
+	}
+	if filters, err := ac.GetContractFilters("other", "k8s"); err != nil || len(filters) != 0 {
+		t.Errorf("got %v (error %v) for a missing contract, want none", filters, err)
+	}
+}
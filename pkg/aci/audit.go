@@ -0,0 +1,103 @@
+package aci
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Audit record of a mutating call to the APIC
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	// SegmentationPolicy (<namespace>/<name>) whose reconcile made the call
+	Policy    string   `json:"policy,omitempty"`
+	Operation string   `json:"operation"`
+	Dn        string   `json:"dn"`
+	Changes   []Change `json:"changes"`
+	// Set if the APIC rejected the call
+	Error string `json:"error,omitempty"`
+}
+
+// Destination of the audit records
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+type policyKey struct{}
+
+// Context of the reconcile of a SegmentationPolicy. The audit records of the calls bound to the context include the policy
+func WithPolicy(ctx context.Context, policy string) context.Context {
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+func policyFromContext(ctx context.Context) string {
+	policy, _ := ctx.Value(policyKey{}).(string)
+	return policy
+}
+
+// Hook recording in the audit sink the objects each call changes on the APIC. Read-only calls are not recorded
+type auditHook struct {
+	sink AuditSink
+	// Read the objects of the call on the APIC before the call, so that only the attributes which change are recorded
+	compare bool
+}
+
+// Record the mutating calls to the APIC client. The SegmentationPolicy of the calls is read from the context the client is bound to.
+// Without compare the objects are recorded as posted by the call. With compare each object is read on the APIC before the call and
+// only the changes are recorded, calls changing nothing are not recorded
+func AuditHook(sink AuditSink, compare bool) Hook {
+	return &auditHook{sink: sink, compare: compare}
+}
+
+// Changes of the call as requested: the objects which are not deleted are created or modified, the APIC is not read to tell them apart
+func postedChanges(desired []Change) []Change {
+	changes := make([]Change, 0, len(desired))
+	for _, change := range desired {
+		if change.Status == ChangeCreated {
+			change.Status = ChangePosted
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func (h *auditHook) Before(ctx context.Context, call *Call) func(err error) {
+	if !call.Mutating() {
+		return func(error) {}
+	}
+	desired := call.Changes
+	if call.Mo != nil {
+		desired = desiredChanges(call.Mo)
+	}
+	changes := postedChanges(desired)
+	if h.compare {
+		// Compare with the APIC before the call. If the APIC cannot be read, the changes of the call are recorded as they are
+		diff, diffErr := DiffChanges(call.Client, desired)
+		if diffErr != nil {
+			log.FromContext(ctx).Error(diffErr, "unable to read the APIC objects of the audit record", "operation", call.Method, "dn", call.Dn)
+		} else {
+			changes = diff
+		}
+	}
+	return func(err error) {
+		// Calls which change nothing on the APIC are not recorded
+		if len(changes) == 0 && err == nil {
+			return
+		}
+		record := AuditRecord{
+			Timestamp: time.Now().UTC(),
+			Policy:    policyFromContext(ctx),
+			Operation: call.Method,
+			Dn:        call.Dn,
+			Changes:   changes,
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		// A failure of the sink does not fail the APIC call, which is already done
+		if sinkErr := h.sink.Record(ctx, record); sinkErr != nil {
+			log.FromContext(ctx).Error(sinkErr, "unable to write the audit record", "operation", call.Method, "dn", call.Dn)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package aci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Key of the audit records in the ConfigMap
+const AuditConfigMapKey = "audit.jsonl"
+
+// Audit records written as JSON lines
+type JSONLinesSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// Append the audit records to the file. "-" writes them to stdout
+func NewAuditLogSink(path string) (*JSONLinesSink, error) {
+	if path == "-" {
+		return NewJSONLinesSink(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the audit log: %w", err)
+	}
+	return NewJSONLinesSink(file), nil
+}
+
+func (s *JSONLinesSink) Record(_ context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// Last audit records kept in a ConfigMap as JSON lines. The oldest records are dropped once MaxRecords is reached
+type ConfigMapSink struct {
+	// The ConfigMap is read from the API server, the cache of the manager only holds the ACI CNI ConfigMap
+	Reader     client.Reader
+	Writer     client.Writer
+	Namespace  string
+	Name       string
+	MaxRecords int
+}
+
+func (s *ConfigMapSink) Record(ctx context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap := &corev1.ConfigMap{}
+		err := s.Reader.Get(ctx, client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, configMap)
+		if errors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: s.Namespace, Name: s.Name},
+				Data:       map[string]string{AuditConfigMapKey: string(line) + "\n"},
+			}
+			return s.Writer.Create(ctx, configMap)
+		}
+		if err != nil {
+			return err
+		}
+		records := strings.Split(strings.TrimSuffix(configMap.Data[AuditConfigMapKey], "\n"), "\n")
+		if len(records) == 1 && records[0] == "" {
+			records = []string{}
+		}
+		records = append(records, string(line))
+		if s.MaxRecords > 0 && len(records) > s.MaxRecords {
+			records = records[len(records)-s.MaxRecords:]
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[AuditConfigMapKey] = strings.Join(records, "\n") + "\n"
+		return s.Writer.Update(ctx, configMap)
+	})
+}
+
+// Write the audit records to several sinks. All the sinks are written even if one fails
+type MultiSink []AuditSink
+
+func (m MultiSink) Record(ctx context.Context, record AuditRecord) error {
+	errs := []string{}
+	for _, sink := range m {
+		if err := sink.Record(ctx, record); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
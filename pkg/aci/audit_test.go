@@ -0,0 +1,93 @@
+package aci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newTestMock() *ApicClientMocks {
+	return &ApicClientMocks{
+		filters:             map[string]filter{},
+		endpointGroups:      map[string]endpointGroup{},
+		contracts:           map[string]contract{},
+		applicationProfiles: map[string]applicationProfile{},
+	}
+}
+
+func TestAuditHook(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	apic := NewHookedClient(newTestMock(), AuditHook(NewJSONLinesSink(buffer), true)).(ContextClient).WithContext(WithPolicy(context.Background(), "default/segpol1"))
+
+	// Read-only calls are not recorded
+	if _, err := apic.EpgExists("ns-a", "Seg_Pol_k8s", "k8s"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := apic.PostTenantConfig(TenantMo("k8s").AddChild(FilterMo("segpol1_iptcp443", "ip", "tcp", 443))); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Calls which change nothing on the APIC are not recorded
+	if err := apic.PostTenantConfig(TenantMo("k8s").AddChild(FilterMo("segpol1_iptcp443", "ip", "tcp", 443))); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := apic.DeleteFilter("k8s", "segpol1_iptcp80"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := apic.DeleteFilter("k8s", "segpol1_iptcp443"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d audit records, want 2: %s", len(lines), buffer.String())
+	}
+	tests := []struct {
+		operation string
+		dn        string
+		changes   int
+	}{
+		{operation: "PostTenantConfig", dn: "uni/tn-k8s", changes: 2},
+		{operation: "DeleteFilter", dn: "uni/tn-k8s/flt-segpol1_iptcp443", changes: 1},
+	}
+	for i, tt := range tests {
+		record := AuditRecord{}
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatalf("invalid audit record %s: %s", lines[i], err)
+		}
+		if record.Operation != tt.operation || record.Dn != tt.dn || record.Policy != "default/segpol1" || len(record.Changes) != tt.changes {
+			t.Errorf("record %d: got %+v, want operation %s, DN %s and %d changes", i, record, tt.operation, tt.dn, tt.changes)
+		}
+	}
+}
+
+func TestAuditHookWithoutCompare(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	apic := NewHookedClient(newTestMock(), AuditHook(NewJSONLinesSink(buffer), false)).(ContextClient).WithContext(WithPolicy(context.Background(), "default/segpol1"))
+
+	// The calls are recorded as posted, even if they change nothing on the APIC
+	for i := 0; i < 2; i++ {
+		if err := apic.PostTenantConfig(TenantMo("k8s").AddChild(FilterMo("segpol1_iptcp443", "ip", "tcp", 443)).AddChild(FilterRefMo("segpol1_iptcp80").Deleted())); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d audit records, want 2: %s", len(lines), buffer.String())
+	}
+	for i, line := range lines {
+		record := AuditRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid audit record %s: %s", line, err)
+		}
+		statuses := map[string]string{}
+		for _, change := range record.Changes {
+			statuses[change.Dn] = change.Status
+		}
+		if statuses["uni/tn-k8s/flt-segpol1_iptcp443"] != ChangePosted || statuses["uni/tn-k8s/flt-segpol1_iptcp80"] != ChangeDeleted {
+			t.Errorf("record %d: got changes %v, want the filter posted and the deleted object", i, statuses)
+		}
+	}
+}
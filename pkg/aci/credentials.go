@@ -0,0 +1,130 @@
+package aci
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Interval between reloads of the APIC credentials. The Secret is not watched, rotated credentials are used up to this interval later
+	credentialsReloadInterval = 60 * time.Second
+
+	// Keys of the credentials Secret
+	CredentialsUsernameKey   = "username"
+	CredentialsPasswordKey   = "password"
+	CredentialsPrivateKeyKey = "private-key"
+	CredentialsCertNameKey   = "cert-name"
+)
+
+// Credentials used to login to the APIC. Either the password or the private key (signature based authentication) must be set
+type Credentials struct {
+	Username   string
+	Password   string
+	PrivateKey string
+	// Name of the user certificate on the APIC. Defaults to <username>.crt
+	CertName string
+}
+
+func (c Credentials) validate() error {
+	if c.Username == "" {
+		return fmt.Errorf("APIC username not defined")
+	}
+	if c.Password == "" && c.PrivateKey == "" {
+		return fmt.Errorf("neither APIC password nor private key defined for user %s", c.Username)
+	}
+	return nil
+}
+
+func (c Credentials) certName() string {
+	if c.CertName != "" {
+		return c.CertName
+	}
+	return fmt.Sprintf("%s.crt", c.Username)
+}
+
+// Source of the credentials used to login to the APIC
+type CredentialsSource func(ctx context.Context) (Credentials, error)
+
+// Credentials that never change
+func StaticCredentials(credentials Credentials) CredentialsSource {
+	return func(_ context.Context) (Credentials, error) {
+		return credentials, nil
+	}
+}
+
+// Credentials stored in a Secret with the keys username and either password or private-key (and optionally cert-name).
+// The username defaults to the one returned by defaultUsername, resolved on every read, if the Secret does not define it
+func CredentialsFromSecret(c client.Reader, namespace, name string, defaultUsername func() string) CredentialsSource {
+	return func(ctx context.Context) (Credentials, error) {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+			return Credentials{}, err
+		}
+		credentials := Credentials{
+			Username:   string(secret.Data[CredentialsUsernameKey]),
+			Password:   string(secret.Data[CredentialsPasswordKey]),
+			PrivateKey: string(secret.Data[CredentialsPrivateKeyKey]),
+			CertName:   string(secret.Data[CredentialsCertNameKey]),
+		}
+		if credentials.Username == "" {
+			credentials.Username = defaultUsername()
+		}
+		if err := credentials.validate(); err != nil {
+			return Credentials{}, fmt.Errorf("invalid credentials in Secret %s/%s: %w", namespace, name, err)
+		}
+		return credentials, nil
+	}
+}
+
+// Read the credentials and replace them, with the session, if they changed (e.g. rotated Secret or new user in the ACI CNI configuration).
+// The new credentials are only used once the APIC accepts them
+func (ac *ApicClient) ReloadCredentials(ctx context.Context) (bool, error) {
+	credentials, err := ac.credentialsSource(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to read the APIC credentials: %w", err)
+	}
+	ac.clientLock.RLock()
+	unchanged := credentials == ac.credentials
+	ac.clientLock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	s, err := ac.loginWith(credentials, "rotation")
+	if err != nil {
+		return false, fmt.Errorf("the APIC rejected the new credentials: %w", err)
+	}
+	// Do not swap the credentials while the session is being refreshed
+	ac.sessionLock.Lock()
+	defer ac.sessionLock.Unlock()
+	ac.clientLock.Lock()
+	defer ac.clientLock.Unlock()
+	ac.credentials, ac.session = credentials, s
+	ac.sessionErrLock.Lock()
+	ac.sessionErr = nil
+	ac.sessionErrLock.Unlock()
+	return true, nil
+}
+
+func (ac *ApicClient) credentialsReloadLoop(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("apic-credentials")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(credentialsReloadInterval):
+		}
+		reloaded, err := ac.ReloadCredentials(ctx)
+		if err != nil {
+			// Keep using the last valid credentials
+			logger.Error(err, "Unable to reload the APIC credentials")
+		} else if reloaded {
+			logger.Info("APIC credentials rotated")
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package aci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCredentialsFromSecret(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "aci-k8s-operator-system", Name: "apic-credentials"},
+		Data:       map[string][]byte{CredentialsPasswordKey: []byte("secret")},
+	}
+	c := fake.NewClientBuilder().WithObjects(secret).Build()
+	username := ""
+	source := CredentialsFromSecret(c, secret.Namespace, secret.Name, func() string { return username })
+
+	if _, err := source(context.Background()); err == nil {
+		t.Errorf("expected the credentials without username to be rejected")
+	}
+	// The default username is resolved on every read
+	username = "k8s-user"
+	credentials, err := source(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := (Credentials{Username: "k8s-user", Password: "secret"}); credentials != want {
+		t.Errorf("got %+v, want %+v", credentials, want)
+	}
+}
+
+func TestReloadCredentialsNewUser(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {})
+	username := "k8s-user"
+	source := func(_ context.Context) (Credentials, error) {
+		return Credentials{Username: username, Password: "secret"}, nil
+	}
+	ac := newTestApicClient(t, source, apic)
+
+	if reloaded, err := ac.ReloadCredentials(context.Background()); err != nil || reloaded {
+		t.Errorf("got reloaded %v (error %v) with the same user, want false", reloaded, err)
+	}
+	username = "k8s-admin"
+	if reloaded, err := ac.ReloadCredentials(context.Background()); err != nil || !reloaded {
+		t.Errorf("got reloaded %v (error %v) with a new user, want true", reloaded, err)
+	}
+	if logins := apic.loginCount(); logins != 2 {
+		t.Errorf("got %d logins, want 2", logins)
+	}
+}
+
+// Rotated credentials only replace the current ones once the APIC accepts them
+func TestReloadCredentialsRotation(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	password := "secret"
+	source := func(_ context.Context) (Credentials, error) {
+		return Credentials{Username: "admin", Password: password}, nil
+	}
+	ac := newTestApicClient(t, source, apic)
+
+	password = "rotated"
+	if reloaded, err := ac.ReloadCredentials(context.Background()); err == nil || reloaded {
+		t.Errorf("got reloaded %v (error %v) with credentials rejected by the APIC, want an error", reloaded, err)
+	}
+	if ac.credentials.Password != "secret" {
+		t.Errorf("got password %s after the rejected rotation, want the previous one", ac.credentials.Password)
+	}
+	if _, err := ac.GetObject("uni/tn-k8s"); err != nil {
+		t.Errorf("unexpected error with the previous credentials: %s", err)
+	}
+
+	apic.lock.Lock()
+	apic.password = "rotated"
+	apic.lock.Unlock()
+	if reloaded, err := ac.ReloadCredentials(context.Background()); err != nil || !reloaded {
+		t.Fatalf("got reloaded %v (error %v) with credentials accepted by the APIC, want true", reloaded, err)
+	}
+	if ac.credentials.Password != "rotated" {
+		t.Errorf("got password %s after the rotation, want the rotated one", ac.credentials.Password)
+	}
+	if _, err := ac.GetObject("uni/tn-k8s"); err != nil {
+		t.Errorf("unexpected error with the rotated credentials: %s", err)
+	}
+}
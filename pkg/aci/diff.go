@@ -0,0 +1,128 @@
+package aci
+
+import "strings"
+
+const (
+	ChangeCreated  = "created"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+	// Object created or modified by the call. The APIC was not read before the call to tell them apart
+	ChangePosted = "posted"
+)
+
+// Object created, modified or deleted on the APIC
+type Change struct {
+	Dn     string `json:"dn"`
+	Class  string `json:"class,omitempty"`
+	Status string `json:"status"`
+	// Attributes which change, with their value on the APIC before the change and the value set by the change.
+	// Deleted objects only have Before, created objects only have After
+	Before map[string]string `json:"before,omitempty"`
+	After  map[string]string `json:"after,omitempty"`
+}
+
+// Attributes the APIC sets on every object, which are not configured by the operator
+var systemAttributes = map[string]bool{
+	"childAction": true, "configIssues": true, "configSt": true, "dn": true, "extMngdBy": true, "forceResolve": true, "lcOwn": true,
+	"modTs": true, "monPolDn": true, "rType": true, "rn": true, "state": true, "stateQual": true, "status": true, "tCl": true,
+	"tContextDn": true, "tRn": true, "tType": true, "uid": true, "userdom": true,
+}
+
+// Names the APIC gives to the well-known ports of the filter entries
+var portNames = map[string]string{
+	"ftpData": "20", "smtp": "25", "dns": "53", "http": "80", "pop3": "110", "https": "443", "rtsp": "554", "unspecified": "0",
+}
+
+func normalizeAttribute(key, value string) string {
+	switch key {
+	case "dFromPort", "dToPort", "sFromPort", "sToPort":
+		if port, ok := portNames[value]; ok {
+			return port
+		}
+	}
+	return value
+}
+
+// Changes a call would make on the APIC: each object with the attributes the call sets, or deleted
+func desiredChanges(mo *ManagedObject) []Change {
+	changes := []Change{}
+	mo.Walk(func(dn string, mo *ManagedObject) {
+		if mo.IsDeleted() {
+			changes = append(changes, Change{Dn: dn, Class: mo.ClassName, Status: ChangeDeleted})
+			return
+		}
+		attributes := map[string]string{}
+		for key, value := range mo.Attributes {
+			if key != "dn" && key != "status" {
+				attributes[key] = value
+			}
+		}
+		changes = append(changes, Change{Dn: dn, Class: mo.ClassName, Status: ChangeCreated, After: attributes})
+	})
+	return changes
+}
+
+// Compare the changes a call would make with the objects on the APIC. Objects already matching the call are left out,
+// created objects which exist on the APIC are reported as modified with only the attributes which change
+func DiffChanges(apic ApicInterface, desired []Change) ([]Change, error) {
+	changes := []Change{}
+	// Objects below a missing object are created without reading them, objects below a deleted object are deleted with it
+	missing, deleted := []string{}, []string{}
+	for _, change := range desired {
+		if below(change.Dn, deleted) {
+			continue
+		}
+		if below(change.Dn, missing) {
+			if change.Status != ChangeDeleted {
+				changes = append(changes, change)
+			}
+			continue
+		}
+		current, err := apic.GetObject(change.Dn)
+		if err != nil {
+			return []Change{}, err
+		}
+		switch {
+		case current == nil:
+			missing = append(missing, change.Dn)
+			if change.Status != ChangeDeleted {
+				changes = append(changes, change)
+			}
+		case change.Status == ChangeDeleted:
+			deleted = append(deleted, change.Dn)
+			before := map[string]string{}
+			for key, value := range current {
+				if !systemAttributes[key] {
+					before[key] = value
+				}
+			}
+			changes = append(changes, Change{Dn: change.Dn, Class: change.Class, Status: ChangeDeleted, Before: before})
+		default:
+			before, after := map[string]string{}, map[string]string{}
+			for key, value := range change.After {
+				if normalizeAttribute(key, current[key]) != value {
+					before[key], after[key] = current[key], value
+				}
+			}
+			if len(after) > 0 {
+				changes = append(changes, Change{Dn: change.Dn, Class: change.Class, Status: ChangeModified, Before: before, After: after})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// Whether the DN is below one of the parent DNs
+func below(dn string, parentDns []string) bool {
+	for _, parentDn := range parentDns {
+		if strings.HasPrefix(dn, parentDn+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare the configuration tree with the objects on the APIC
+func DiffMo(apic ApicInterface, mo *ManagedObject) ([]Change, error) {
+	return DiffChanges(apic, desiredChanges(mo))
+}
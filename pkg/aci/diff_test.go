@@ -0,0 +1,93 @@
+package aci
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffMo(t *testing.T) {
+	apic := newTestMock()
+	apic.CreateApplicationProfile("Seg_Pol_k8s", "", "k8s")
+	apic.CreateEndpointGroup("ns-a", "", "Seg_Pol_k8s", "k8s", "bd", "vmm")
+	apic.CreateEndpointGroup("ns-b", "", "Seg_Pol_k8s", "k8s", "bd", "vmm")
+	apic.AddTagAnnotationToEpg("ns-b", "Seg_Pol_k8s", "k8s", "segpol1", "segpol1")
+	apic.CreateFilterAndFilterEntry("k8s", "segpol1_iptcp80", "ip", "tcp", 80)
+
+	tests := []struct {
+		name     string
+		tenantMo *ManagedObject
+		want     []Change
+	}{
+		{
+			name: "unchanged",
+			tenantMo: TenantMo("k8s").AddChild(
+				ApplicationProfileRefMo("Seg_Pol_k8s").AddChild(EndpointGroupRefMo("ns-a")),
+				FilterMo("segpol1_iptcp80", "ip", "tcp", 80),
+			),
+			want: []Change{},
+		},
+		{
+			name: "created",
+			tenantMo: TenantMo("k8s").AddChild(
+				ApplicationProfileRefMo("Seg_Pol_k8s").AddChild(EndpointGroupRefMo("ns-a").AddChild(ContractConsumerMo("segpol1"))),
+				FilterMo("segpol1_iptcp443", "ip", "tcp", 443),
+			),
+			want: []Change{
+				{Dn: "uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a/rscons-segpol1", Class: "fvRsCons", Status: ChangeCreated, After: map[string]string{"tnVzBrCPName": "segpol1"}},
+				{Dn: "uni/tn-k8s/flt-segpol1_iptcp443", Class: "vzFilter", Status: ChangeCreated, After: map[string]string{"name": "segpol1_iptcp443", "annotation": "orchestrator:kubernetes"}},
+				{Dn: "uni/tn-k8s/flt-segpol1_iptcp443/e-segpol1_iptcp443", Class: "vzEntry", Status: ChangeCreated, After: map[string]string{"name": "segpol1_iptcp443", "etherT": "ip", "prot": "tcp", "dFromPort": "443", "dToPort": "443"}},
+			},
+		},
+		{
+			name: "modified",
+			tenantMo: TenantMo("k8s").AddChild(
+				ApplicationProfileRefMo("Seg_Pol_k8s").AddChild(EndpointGroupRefMo("ns-a").WithEpgSettings(EpgSettings{IntraEpgIsolation: true})),
+			),
+			want: []Change{
+				{Dn: "uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a", Class: "fvAEPg", Status: ChangeModified, Before: map[string]string{"pcEnfPref": "unenforced"}, After: map[string]string{"pcEnfPref": "enforced"}},
+			},
+		},
+		{
+			name: "deleted",
+			tenantMo: TenantMo("k8s").AddChild(
+				ApplicationProfileRefMo("Seg_Pol_k8s").AddChild(
+					EndpointGroupRefMo("ns-a").AddChild(TagAnnotationMo("segpol1", "segpol1").Deleted()),
+					EndpointGroupRefMo("ns-b").AddChild(TagAnnotationMo("segpol1", "segpol1").Deleted()).Deleted(),
+				),
+				FilterRefMo("segpol1_iptcp443").Deleted(),
+			),
+			want: []Change{
+				{Dn: "uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-b", Class: "fvAEPg", Status: ChangeDeleted, Before: map[string]string{
+					"name": "ns-b", "descr": "", "annotation": "orchestrator:kubernetes", "pcEnfPref": "unenforced", "prefGrMemb": "exclude", "floodOnEncap": "disabled",
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffMo(apic, tt.tenantMo)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAttribute(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"dFromPort", "http", "80"},
+		{"dToPort", "https", "443"},
+		{"dFromPort", "8080", "8080"},
+		{"name", "http", "http"},
+	}
+	for _, tt := range tests {
+		if got := normalizeAttribute(tt.key, tt.value); got != tt.want {
+			t.Errorf("normalizeAttribute(%s, %s) = %s, want %s", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package aci
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Interval between health checks of the APIC cluster members
+	healthCheckInterval = 30 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+	// Host of the requests built by the aci-go-client. It is replaced by the active APIC
+	apicPlaceholderHost = "apic.invalid"
+)
+
+// Name of the APIC currently receiving the requests. Empty if no APIC is configured
+func (ac *ApicClient) ActiveHost() string {
+	ac.hostsLock.RLock()
+	defer ac.hostsLock.RUnlock()
+	if len(ac.hosts) == 0 {
+		return ""
+	}
+	return ac.hosts[ac.active]
+}
+
+func (ac *ApicClient) hostCount() int {
+	ac.hostsLock.RLock()
+	defer ac.hostsLock.RUnlock()
+	return len(ac.hosts)
+}
+
+// Move the requests to the next APIC of the cluster, preferring healthy members. Nothing changes if another request already failed over
+func (ac *ApicClient) failover(failedHost string) string {
+	ac.hostsLock.Lock()
+	defer ac.hostsLock.Unlock()
+	if ac.hosts[ac.active] != failedHost {
+		return ac.hosts[ac.active]
+	}
+	ac.healthy[failedHost] = false
+	next := (ac.active + 1) % len(ac.hosts)
+	for i := 1; i < len(ac.hosts); i++ {
+		candidate := (ac.active + i) % len(ac.hosts)
+		if ac.healthy[ac.hosts[candidate]] {
+			next = candidate
+			break
+		}
+	}
+	ac.active = next
+	ac.updateHostMetrics()
+	return ac.hosts[ac.active]
+}
+
+// Must be called holding the hostsLock
+func (ac *ApicClient) updateHostMetrics() {
+	for i, host := range ac.hosts {
+		active, up := 0.0, 0.0
+		if i == ac.active {
+			active = 1
+		}
+		if ac.healthy[host] {
+			up = 1
+		}
+		apicActiveController.WithLabelValues(host).Set(active)
+		apicControllerUp.WithLabelValues(host).Set(up)
+	}
+}
+
+// Check whether every APIC of the cluster answers. If the active APIC is down, the requests are moved to a healthy one
+func (ac *ApicClient) checkHosts(ctx context.Context) {
+	ac.hostsLock.RLock()
+	hosts := ac.hosts
+	ac.hostsLock.RUnlock()
+	if len(hosts) == 0 {
+		return
+	}
+	results := map[string]bool{}
+	for _, host := range hosts {
+		httpClient := &http.Client{Transport: ac.hostTransport(host), Timeout: healthCheckTimeout}
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://%s/api/aaaListDomains.json", host), nil)
+		if err != nil {
+			results[host] = false
+			continue
+		}
+		resp, err := httpClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		results[host] = err == nil && resp.StatusCode < http.StatusInternalServerError
+	}
+
+	ac.hostsLock.Lock()
+	defer ac.hostsLock.Unlock()
+	// The hosts were replaced during the health check
+	if strings.Join(ac.hosts, ",") != strings.Join(hosts, ",") {
+		return
+	}
+	ac.healthy = results
+	if !ac.healthy[ac.hosts[ac.active]] {
+		for i, host := range ac.hosts {
+			if ac.healthy[host] {
+				ac.active = i
+				break
+			}
+		}
+	}
+	ac.updateHostMetrics()
+}
+
+func (ac *ApicClient) healthCheckLoop(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("apic-health")
+	for {
+		ac.checkHosts(ctx)
+		logger.V(1).Info(fmt.Sprintf("Active APIC %s", ac.ActiveHost()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(healthCheckInterval):
+		}
+	}
+}
+
+// Readiness check reporting whether the APIC session is valid and the active APIC is reachable
+func (ac *ApicClient) ReadyzCheck(_ *http.Request) error {
+	if err := ac.SessionError(); err != nil {
+		return fmt.Errorf("unable to login to the APIC: %w", err)
+	}
+	ac.hostsLock.RLock()
+	defer ac.hostsLock.RUnlock()
+	if len(ac.hosts) == 0 {
+		return fmt.Errorf("no APIC configured")
+	}
+	if !ac.healthy[ac.hosts[ac.active]] {
+		return fmt.Errorf("APIC %s is not reachable", ac.hosts[ac.active])
+	}
+	return nil
+}
+
+// HTTP transport that sends every request to the active APIC and fails over to the next APIC of the cluster on connection errors
+type failoverTransport struct {
+	ac *ApicClient
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	host := t.ac.ActiveHost()
+	if host == "" {
+		return nil, fmt.Errorf("no APIC configured")
+	}
+	err := fmt.Errorf("no APIC reachable")
+	for attempt := 0; attempt < t.ac.hostCount(); attempt++ {
+		hostReq := req.Clone(req.Context())
+		hostReq.URL.Host = host
+		hostReq.Host = host
+		hostReq.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		var resp *http.Response
+		resp, err = t.ac.hostTransport(host).RoundTrip(hostReq)
+		if err == nil || req.Context().Err() != nil {
+			return resp, err
+		}
+		host = t.ac.failover(host)
+	}
+	return nil, err
+}
@@ -0,0 +1,57 @@
+package aci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestFailover(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, apicEmptyResponse)
+	}
+	apic1, apic2 := newFakeApic(t, "secret", handler), newFakeApic(t, "secret", handler)
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic1, apic2)
+	if host := ac.ActiveHost(); host != apic1.host() {
+		t.Fatalf("got active APIC %s, want %s", host, apic1.host())
+	}
+
+	// The request is sent again to the next APIC, which does not know the session token of the first one
+	apic1.server.Close()
+	if _, err := ac.GetObject("uni/tn-k8s"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if host := ac.ActiveHost(); host != apic2.host() {
+		t.Errorf("got active APIC %s, want %s", host, apic2.host())
+	}
+	if logins := apic2.loginCount(); logins != 1 {
+		t.Errorf("got %d logins to the second APIC, want 1", logins)
+	}
+
+	apic2.server.Close()
+	if _, err := ac.GetObject("uni/tn-k8s"); err == nil {
+		t.Errorf("expected an error without reachable APIC")
+	}
+}
+
+func TestCheckHosts(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, apicEmptyResponse)
+	}
+	apic1, apic2 := newFakeApic(t, "secret", handler), newFakeApic(t, "secret", handler)
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic1, apic2)
+
+	ac.checkHosts(context.Background())
+	if host := ac.ActiveHost(); host != apic1.host() {
+		t.Errorf("got active APIC %s with all the APICs up, want %s", host, apic1.host())
+	}
+	apic1.server.Close()
+	ac.checkHosts(context.Background())
+	if host := ac.ActiveHost(); host != apic2.host() {
+		t.Errorf("got active APIC %s, want %s", host, apic2.host())
+	}
+	if err := ac.ReadyzCheck(nil); err != nil {
+		t.Errorf("unexpected readiness error: %s", err)
+	}
+}
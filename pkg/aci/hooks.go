@@ -0,0 +1,375 @@
+package aci
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// APIC client which can be bound to a context. The hooks of the calls of the bound client receive the context of the caller
+type ContextClient interface {
+	WithContext(ctx context.Context) ApicInterface
+}
+
+// Call of an ApicInterface method
+type Call struct {
+	Method string
+	// DN of the APIC object of the call
+	Dn string
+	// Objects created, modified or deleted by the call. Nil for read-only calls and PostTenantConfig, whose configuration tree is Mo
+	Changes []Change
+	Mo      *ManagedObject
+	// Client bound to the context of the caller. Hooks can use it to read the APIC
+	Client ApicInterface
+}
+
+// Whether the call writes to the APIC
+func (c *Call) Mutating() bool {
+	return c.Changes != nil || c.Mo != nil
+}
+
+// Hook run around every call of the APIC client (tracing, metrics, audit). Before is called before the call with the context
+// the client is bound to, and returns the function called with the error of the call
+type Hook interface {
+	Before(ctx context.Context, call *Call) func(err error)
+}
+
+// ApicInterface wrapper running the hooks around every call. The hooks are run in order before the call and in reverse order after it
+type hookedClient struct {
+	client ApicInterface
+	ctx    context.Context
+	hooks  []Hook
+}
+
+// Run the hooks around the calls to the APIC client. The returned client implements ContextClient to pass the context of the caller to the hooks
+func NewHookedClient(client ApicInterface, hooks ...Hook) ApicInterface {
+	return &hookedClient{client: client, ctx: context.Background(), hooks: hooks}
+}
+
+func (c *hookedClient) WithContext(ctx context.Context) ApicInterface {
+	client := c.client
+	if contextClient, ok := client.(ContextClient); ok {
+		client = contextClient.WithContext(ctx)
+	}
+	return &hookedClient{client: client, ctx: ctx, hooks: c.hooks}
+}
+
+// APIC client which can be bound to a single call to report the HTTP status of its errors
+type statusClient interface {
+	withStatus() (ApicInterface, *statusRecorder)
+}
+
+func (c *hookedClient) do(call Call, fn func(client ApicInterface) error) error {
+	call.Client = c
+	after := make([]func(error), len(c.hooks))
+	for i, hook := range c.hooks {
+		after[i] = hook.Before(c.ctx, &call)
+	}
+	var err error
+	if client, ok := c.client.(statusClient); ok {
+		callClient, status := client.withStatus()
+		err = status.wrap(fn(callClient))
+	} else {
+		err = fn(c.client)
+	}
+	for i := len(after) - 1; i >= 0; i-- {
+		after[i](err)
+	}
+	return err
+}
+
+func tenantDn(tenantName string) string {
+	return fmt.Sprintf("uni/tn-%s", tenantName)
+}
+
+func appDn(tenantName, appName string) string {
+	return fmt.Sprintf("uni/tn-%s/ap-%s", tenantName, appName)
+}
+
+func epgDn(tenantName, appName, epgName string) string {
+	return fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appName, epgName)
+}
+
+func filterDn(tenantName, filterName string) string {
+	return fmt.Sprintf("uni/tn-%s/flt-%s", tenantName, filterName)
+}
+
+func contractDn(tenantName, contractName string) string {
+	return fmt.Sprintf("uni/tn-%s/brc-%s", tenantName, contractName)
+}
+
+// Change of a call creating or modifying a single object
+func created(dn string, attributes map[string]string) []Change {
+	return []Change{{Dn: dn, Status: ChangeCreated, After: attributes}}
+}
+
+// Change of a call deleting a single object
+func deleted(dn string) []Change {
+	return []Change{{Dn: dn, Status: ChangeDeleted}}
+}
+
+func (c *hookedClient) PostTenantConfig(tenantMo *ManagedObject) error {
+	return c.do(Call{Method: "PostTenantConfig", Dn: tenantMo.Attributes["dn"], Mo: tenantMo}, func(client ApicInterface) error {
+		return client.PostTenantConfig(tenantMo)
+	})
+}
+
+func (c *hookedClient) CreateTenant(name, description string) error {
+	dn := tenantDn(name)
+	return c.do(Call{Method: "CreateTenant", Dn: dn, Changes: created(dn, map[string]string{"name": name, "descr": description})}, func(client ApicInterface) error {
+		return client.CreateTenant(name, description)
+	})
+}
+
+func (c *hookedClient) DeleteTenant(name string) error {
+	dn := tenantDn(name)
+	return c.do(Call{Method: "DeleteTenant", Dn: dn, Changes: deleted(dn)}, func(client ApicInterface) error {
+		return client.DeleteTenant(name)
+	})
+}
+
+func (c *hookedClient) CreateApplicationProfile(name, description, tenantName string) error {
+	dn := appDn(tenantName, name)
+	changes := created(dn, map[string]string{"name": name, "descr": description, "annotation": "orchestrator:kubernetes"})
+	return c.do(Call{Method: "CreateApplicationProfile", Dn: dn, Changes: changes}, func(client ApicInterface) error {
+		return client.CreateApplicationProfile(name, description, tenantName)
+	})
+}
+
+func (c *hookedClient) DeleteApplicationProfile(name, tenantName string) error {
+	dn := appDn(tenantName, name)
+	return c.do(Call{Method: "DeleteApplicationProfile", Dn: dn, Changes: deleted(dn)}, func(client ApicInterface) error {
+		return client.DeleteApplicationProfile(name, tenantName)
+	})
+}
+
+func (c *hookedClient) ApplicationProfileExists(name, tenantName string) (exists bool, err error) {
+	err = c.do(Call{Method: "ApplicationProfileExists", Dn: appDn(tenantName, name)}, func(client ApicInterface) (err error) {
+		exists, err = client.ApplicationProfileExists(name, tenantName)
+		return err
+	})
+	return exists, err
+}
+
+func (c *hookedClient) EmptyApplicationProfile(name, tenantName string) (empty bool, err error) {
+	err = c.do(Call{Method: "EmptyApplicationProfile", Dn: appDn(tenantName, name)}, func(client ApicInterface) (err error) {
+		empty, err = client.EmptyApplicationProfile(name, tenantName)
+		return err
+	})
+	return empty, err
+}
+
+func (c *hookedClient) CreateEndpointGroup(name, description, appName, tenantName, bdName, vmmName string) error {
+	dn := epgDn(tenantName, appName, name)
+	domDn := fmt.Sprintf("uni/vmmp-Kubernetes/dom-%s", vmmName)
+	changes := created(dn, map[string]string{"name": name, "descr": description, "annotation": "orchestrator:kubernetes"})
+	changes = append(changes, created(fmt.Sprintf("%s/rsbd", dn), map[string]string{"tnFvBDName": bdName})...)
+	changes = append(changes, created(fmt.Sprintf("%s/rsdomAtt-[%s]", dn, domDn), map[string]string{"tDn": domDn})...)
+	return c.do(Call{Method: "CreateEndpointGroup", Dn: dn, Changes: changes}, func(client ApicInterface) error {
+		return client.CreateEndpointGroup(name, description, appName, tenantName, bdName, vmmName)
+	})
+}
+
+func (c *hookedClient) DeleteEndpointGroup(name, appName, tenantName string) error {
+	dn := epgDn(tenantName, appName, name)
+	return c.do(Call{Method: "DeleteEndpointGroup", Dn: dn, Changes: deleted(dn)}, func(client ApicInterface) error {
+		return client.DeleteEndpointGroup(name, appName, tenantName)
+	})
+}
+
+func (c *hookedClient) CreateFilterAndFilterEntry(tenantName, name, eth, ip string, port int) error {
+	dn := filterDn(tenantName, name)
+	changes := created(dn, map[string]string{"name": name, "annotation": "orchestrator:kubernetes"})
+	entry := map[string]string{"etherT": eth, "prot": ip, "dFromPort": strconv.Itoa(port), "dToPort": strconv.Itoa(port)}
+	changes = append(changes, created(fmt.Sprintf("%s/e-%s", dn, name), entry)...)
+	return c.do(Call{Method: "CreateFilterAndFilterEntry", Dn: dn, Changes: changes}, func(client ApicInterface) error {
+		return client.CreateFilterAndFilterEntry(tenantName, name, eth, ip, port)
+	})
+}
+
+func (c *hookedClient) DeleteFilter(tenantName, name string) error {
+	dn := filterDn(tenantName, name)
+	return c.do(Call{Method: "DeleteFilter", Dn: dn, Changes: deleted(dn)}, func(client ApicInterface) error {
+		return client.DeleteFilter(tenantName, name)
+	})
+}
+
+func (c *hookedClient) FilterExists(name, tenantName string) (exists bool, err error) {
+	err = c.do(Call{Method: "FilterExists", Dn: filterDn(tenantName, name)}, func(client ApicInterface) (err error) {
+		exists, err = client.FilterExists(name, tenantName)
+		return err
+	})
+	return exists, err
+}
+
+func (c *hookedClient) CreateContract(tenantName, name string, filters []string) error {
+	dn := contractDn(tenantName, name)
+	subjDn := fmt.Sprintf("%s/subj-%s", dn, name)
+	changes := created(dn, map[string]string{"name": name, "annotation": "orchestrator:kubernetes"})
+	changes = append(changes, created(subjDn, map[string]string{"name": name, "revFltPorts": "yes"})...)
+	for _, flt := range filters {
+		changes = append(changes, created(fmt.Sprintf("%s/rssubjFiltAtt-%s", subjDn, flt), map[string]string{"tnVzFilterName": flt})...)
+	}
+	return c.do(Call{Method: "CreateContract", Dn: dn, Changes: changes}, func(client ApicInterface) error {
+		return client.CreateContract(tenantName, name, filters)
+	})
+}
+
+func (c *hookedClient) DeleteContract(tenantName, name string) error {
+	dn := contractDn(tenantName, name)
+	return c.do(Call{Method: "DeleteContract", Dn: dn, Changes: deleted(dn)}, func(client ApicInterface) error {
+		return client.DeleteContract(tenantName, name)
+	})
+}
+
+func (c *hookedClient) InheritContractFromMaster(epgName, appName, tenantName, appMasterName, epgMasterName string) error {
+	masterDn := epgDn(tenantName, appMasterName, epgMasterName)
+	changes := created(fmt.Sprintf("%s/rssecInherited-[%s]", epgDn(tenantName, appName, epgName), masterDn), map[string]string{"tDn": masterDn})
+	return c.do(Call{Method: "InheritContractFromMaster", Dn: epgDn(tenantName, appName, epgName), Changes: changes}, func(client ApicInterface) error {
+		return client.InheritContractFromMaster(epgName, appName, tenantName, appMasterName, epgMasterName)
+	})
+}
+
+func (c *hookedClient) EpgExists(name, appName, tenantName string) (exists bool, err error) {
+	err = c.do(Call{Method: "EpgExists", Dn: epgDn(tenantName, appName, name)}, func(client ApicInterface) (err error) {
+		exists, err = client.EpgExists(name, appName, tenantName)
+		return err
+	})
+	return exists, err
+}
+
+func (c *hookedClient) GetEpgSettings(name, appName, tenantName string) (settings EpgSettings, err error) {
+	err = c.do(Call{Method: "GetEpgSettings", Dn: epgDn(tenantName, appName, name)}, func(client ApicInterface) (err error) {
+		settings, err = client.GetEpgSettings(name, appName, tenantName)
+		return err
+	})
+	return settings, err
+}
+
+func (c *hookedClient) GetEpgDomains(name, appName, tenantName string) (bd string, vmms []string, err error) {
+	err = c.do(Call{Method: "GetEpgDomains", Dn: epgDn(tenantName, appName, name)}, func(client ApicInterface) (err error) {
+		bd, vmms, err = client.GetEpgDomains(name, appName, tenantName)
+		return err
+	})
+	return bd, vmms, err
+}
+
+func (c *hookedClient) AddTagAnnotationToEpg(name, appName, tenantName, key, value string) error {
+	changes := created(fmt.Sprintf("%s/annotationKey-[%s]", epgDn(tenantName, appName, name), key), map[string]string{"key": key, "value": value})
+	return c.do(Call{Method: "AddTagAnnotationToEpg", Dn: epgDn(tenantName, appName, name), Changes: changes}, func(client ApicInterface) error {
+		return client.AddTagAnnotationToEpg(name, appName, tenantName, key, value)
+	})
+}
+
+func (c *hookedClient) RemoveTagAnnotation(name, appName, tenantName, key string) error {
+	changes := deleted(fmt.Sprintf("%s/annotationKey-[%s]", epgDn(tenantName, appName, name), key))
+	return c.do(Call{Method: "RemoveTagAnnotation", Dn: epgDn(tenantName, appName, name), Changes: changes}, func(client ApicInterface) error {
+		return client.RemoveTagAnnotation(name, appName, tenantName, key)
+	})
+}
+
+func (c *hookedClient) GetEpgWithAnnotation(appName, tenantName, key string) (epgs []string, err error) {
+	err = c.do(Call{Method: "GetEpgWithAnnotation", Dn: appDn(tenantName, appName)}, func(client ApicInterface) (err error) {
+		epgs, err = client.GetEpgWithAnnotation(appName, tenantName, key)
+		return err
+	})
+	return epgs, err
+}
+
+func (c *hookedClient) GetAnnotationsEpg(name, appName, tenantName string) (keys []string, err error) {
+	err = c.do(Call{Method: "GetAnnotationsEpg", Dn: epgDn(tenantName, appName, name)}, func(client ApicInterface) (err error) {
+		keys, err = client.GetAnnotationsEpg(name, appName, tenantName)
+		return err
+	})
+	return keys, err
+}
+
+func (c *hookedClient) AddTagAnnotationToFilter(name, tenantName, key, value string) error {
+	changes := created(fmt.Sprintf("%s/annotationKey-[%s]", filterDn(tenantName, name), key), map[string]string{"key": key, "value": value})
+	return c.do(Call{Method: "AddTagAnnotationToFilter", Dn: filterDn(tenantName, name), Changes: changes}, func(client ApicInterface) error {
+		return client.AddTagAnnotationToFilter(name, tenantName, key, value)
+	})
+}
+
+func (c *hookedClient) GetFilterWithAnnotation(tenantName, key string) (filters []string, err error) {
+	err = c.do(Call{Method: "GetFilterWithAnnotation", Dn: tenantDn(tenantName)}, func(client ApicInterface) (err error) {
+		filters, err = client.GetFilterWithAnnotation(tenantName, key)
+		return err
+	})
+	return filters, err
+}
+
+func (c *hookedClient) ConsumeContract(epgName, appName, tenantName, conName string) error {
+	changes := created(fmt.Sprintf("%s/rscons-%s", epgDn(tenantName, appName, epgName), conName), map[string]string{"tnVzBrCPName": conName})
+	return c.do(Call{Method: "ConsumeContract", Dn: epgDn(tenantName, appName, epgName), Changes: changes}, func(client ApicInterface) error {
+		return client.ConsumeContract(epgName, appName, tenantName, conName)
+	})
+}
+
+func (c *hookedClient) ProvideContract(epgName, appName, tenantName, conName string) error {
+	changes := created(fmt.Sprintf("%s/rsprov-%s", epgDn(tenantName, appName, epgName), conName), map[string]string{"tnVzBrCPName": conName})
+	return c.do(Call{Method: "ProvideContract", Dn: epgDn(tenantName, appName, epgName), Changes: changes}, func(client ApicInterface) error {
+		return client.ProvideContract(epgName, appName, tenantName, conName)
+	})
+}
+
+func (c *hookedClient) DeleteContractConsumer(epgName, appName, tenantName, conName string) error {
+	changes := deleted(fmt.Sprintf("%s/rscons-%s", epgDn(tenantName, appName, epgName), conName))
+	return c.do(Call{Method: "DeleteContractConsumer", Dn: epgDn(tenantName, appName, epgName), Changes: changes}, func(client ApicInterface) error {
+		return client.DeleteContractConsumer(epgName, appName, tenantName, conName)
+	})
+}
+
+func (c *hookedClient) DeleteContractProvider(epgName, appName, tenantName, conName string) error {
+	changes := deleted(fmt.Sprintf("%s/rsprov-%s", epgDn(tenantName, appName, epgName), conName))
+	return c.do(Call{Method: "DeleteContractProvider", Dn: epgDn(tenantName, appName, epgName), Changes: changes}, func(client ApicInterface) error {
+		return client.DeleteContractProvider(epgName, appName, tenantName, conName)
+	})
+}
+
+func (c *hookedClient) GetContractFilters(contractName, tenantName string) (filters []string, err error) {
+	err = c.do(Call{Method: "GetContractFilters", Dn: contractDn(tenantName, contractName)}, func(client ApicInterface) (err error) {
+		filters, err = client.GetContractFilters(contractName, tenantName)
+		return err
+	})
+	return filters, err
+}
+
+func (c *hookedClient) DeleteFilterFromSubjectContract(subjectName, tenantName, filter string) error {
+	changes := deleted(fmt.Sprintf("%s/subj-%s/rssubjFiltAtt-%s", contractDn(tenantName, subjectName), subjectName, filter))
+	return c.do(Call{Method: "DeleteFilterFromSubjectContract", Dn: contractDn(tenantName, subjectName), Changes: changes}, func(client ApicInterface) error {
+		return client.DeleteFilterFromSubjectContract(subjectName, tenantName, filter)
+	})
+}
+
+func (c *hookedClient) GetContracts(epgName, appName, tenantName string) (contracts map[string][]string, err error) {
+	err = c.do(Call{Method: "GetContracts", Dn: epgDn(tenantName, appName, epgName)}, func(client ApicInterface) (err error) {
+		contracts, err = client.GetContracts(epgName, appName, tenantName)
+		return err
+	})
+	return contracts, err
+}
+
+func (c *hookedClient) GetTaggedObjects(tenantName string) (objects map[string]map[string]string, err error) {
+	err = c.do(Call{Method: "GetTaggedObjects", Dn: tenantDn(tenantName)}, func(client ApicInterface) (err error) {
+		objects, err = client.GetTaggedObjects(tenantName)
+		return err
+	})
+	return objects, err
+}
+
+func (c *hookedClient) GetObject(dn string) (attributes map[string]string, err error) {
+	err = c.do(Call{Method: "GetObject", Dn: dn}, func(client ApicInterface) (err error) {
+		attributes, err = client.GetObject(dn)
+		return err
+	})
+	return attributes, err
+}
+
+func (c *hookedClient) GetManagedContracts(tenantName string) (contracts []string, err error) {
+	err = c.do(Call{Method: "GetManagedContracts", Dn: tenantDn(tenantName)}, func(client ApicInterface) (err error) {
+		contracts, err = client.GetManagedContracts(tenantName)
+		return err
+	})
+	return contracts, err
+}
@@ -0,0 +1,228 @@
+package aci
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/ciscoecosystem/aci-go-client/models"
+)
+
+// Managed Object (MO) of the APIC Management Information Tree. Nested MOs are posted to the APIC
+// in a single request, which the APIC applies as one transaction (all or nothing)
+type ManagedObject struct {
+	ClassName  string
+	Attributes map[string]string
+	Children   []*ManagedObject
+}
+
+func NewManagedObject(className string, attributes map[string]string) *ManagedObject {
+	return &ManagedObject{ClassName: className, Attributes: attributes, Children: []*ManagedObject{}}
+}
+
+// Add child MOs and return the parent MO
+func (mo *ManagedObject) AddChild(children ...*ManagedObject) *ManagedObject {
+	mo.Children = append(mo.Children, children...)
+	return mo
+}
+
+// Mark the MO to be deleted from the APIC and return it
+func (mo *ManagedObject) Deleted() *ManagedObject {
+	mo.Attributes["status"] = "deleted"
+	return mo
+}
+
+func (mo *ManagedObject) IsDeleted() bool {
+	return mo.Attributes["status"] == "deleted"
+}
+
+// Remove the annotation identifying the MO as managed by the operator and return it
+func (mo *ManagedObject) Unmanaged() *ManagedObject {
+	mo.Attributes["annotation"] = ""
+	return mo
+}
+
+// Get the first child MO of a given class whose naming attribute matches the value
+func (mo *ManagedObject) GetChild(className, attribute, value string) *ManagedObject {
+	for _, child := range mo.Children {
+		if child.ClassName == className && child.Attributes[attribute] == value {
+			return child
+		}
+	}
+	return nil
+}
+
+// Relative name of the MO under its parent
+func (mo *ManagedObject) Rn() string {
+	switch mo.ClassName {
+	case models.FvtenantClassName:
+		return fmt.Sprintf("tn-%s", mo.Attributes["name"])
+	case models.FvapClassName:
+		return fmt.Sprintf("ap-%s", mo.Attributes["name"])
+	case models.FvaepgClassName:
+		return fmt.Sprintf("epg-%s", mo.Attributes["name"])
+	case "fvRsBd":
+		return "rsbd"
+	case models.FvrsdomattClassName:
+		return fmt.Sprintf("rsdomAtt-[%s]", mo.Attributes["tDn"])
+	case models.TagAnnotationClassName:
+		return fmt.Sprintf("annotationKey-[%s]", mo.Attributes["key"])
+	case models.FvrsconsClassName:
+		return fmt.Sprintf("rscons-%s", mo.Attributes["tnVzBrCPName"])
+	case models.FvrsprovClassName:
+		return fmt.Sprintf("rsprov-%s", mo.Attributes["tnVzBrCPName"])
+	case "fvRsSecInherited":
+		return fmt.Sprintf("rssecInherited-[%s]", mo.Attributes["tDn"])
+	case models.VzbrcpClassName:
+		return fmt.Sprintf("brc-%s", mo.Attributes["name"])
+	case models.VzsubjClassName:
+		return fmt.Sprintf("subj-%s", mo.Attributes["name"])
+	case models.VzrssubjfiltattClassName:
+		return fmt.Sprintf("rssubjFiltAtt-%s", mo.Attributes["tnVzFilterName"])
+	case models.VzfilterClassName:
+		return fmt.Sprintf("flt-%s", mo.Attributes["name"])
+	case models.VzentryClassName:
+		return fmt.Sprintf("e-%s", mo.Attributes["name"])
+	}
+	return mo.ClassName
+}
+
+// Call the function for the MO and all its children with their DN. The DN of the root MO is read from its dn attribute
+func (mo *ManagedObject) Walk(fn func(dn string, mo *ManagedObject)) {
+	mo.walk(mo.Attributes["dn"], fn)
+}
+
+func (mo *ManagedObject) walk(dn string, fn func(dn string, mo *ManagedObject)) {
+	fn(dn, mo)
+	for _, child := range mo.Children {
+		child.walk(fmt.Sprintf("%s/%s", dn, child.Rn()), fn)
+	}
+}
+
+// Serialize the MO using the APIC JSON format: {"<class>": {"attributes": {...}, "children": [...]}}
+func (mo *ManagedObject) MarshalJSON() ([]byte, error) {
+	body := map[string]interface{}{"attributes": mo.Attributes}
+	if len(mo.Children) > 0 {
+		body["children"] = mo.Children
+	}
+	return json.Marshal(map[string]interface{}{mo.ClassName: body})
+}
+
+/*
+	Managed Object builders
+*/
+func TenantMo(name string) *ManagedObject {
+	return NewManagedObject(models.FvtenantClassName, map[string]string{"dn": fmt.Sprintf("uni/tn-%s", name), "name": name})
+}
+
+func ApplicationProfileMo(name, description string) *ManagedObject {
+	return NewManagedObject(models.FvapClassName, map[string]string{"name": name, "descr": description, "annotation": "orchestrator:kubernetes"})
+}
+
+func ApplicationProfileRefMo(name string) *ManagedObject {
+	return NewManagedObject(models.FvapClassName, map[string]string{"name": name})
+}
+
+// EPG linked to the Bridge Domain and Kubernetes VMM Domain
+func EndpointGroupMo(name, description, bdName, vmmName string) *ManagedObject {
+	return NewManagedObject(models.FvaepgClassName, map[string]string{"name": name, "descr": description, "annotation": "orchestrator:kubernetes"}).AddChild(
+		NewManagedObject("fvRsBd", map[string]string{"tnFvBDName": bdName}),
+		NewManagedObject(models.FvrsdomattClassName, map[string]string{"tDn": fmt.Sprintf("uni/vmmp-Kubernetes/dom-%s", vmmName)}),
+	)
+}
+
+// EPG used only as parent of other MOs. Its attributes are left untouched on the APIC
+func EndpointGroupRefMo(name string) *ManagedObject {
+	return NewManagedObject(models.FvaepgClassName, map[string]string{"name": name})
+}
+
+// Settings of an EPG configurable per Namespace. The zero value matches the defaults of the APIC
+type EpgSettings struct {
+	// Endpoints of the EPG cannot communicate with each other
+	IntraEpgIsolation bool
+	// The EPG is a member of the preferred group of its VRF
+	PreferredGroup bool
+	FloodOnEncap   bool
+}
+
+// Attributes of the fvAEPg MO setting the EPG settings
+func (s EpgSettings) Attributes() map[string]string {
+	attributes := map[string]string{"pcEnfPref": "unenforced", "prefGrMemb": "exclude", "floodOnEncap": "disabled"}
+	if s.IntraEpgIsolation {
+		attributes["pcEnfPref"] = "enforced"
+	}
+	if s.PreferredGroup {
+		attributes["prefGrMemb"] = "include"
+	}
+	if s.FloodOnEncap {
+		attributes["floodOnEncap"] = "enabled"
+	}
+	return attributes
+}
+
+// Read the EPG settings from the attributes of a fvAEPg MO
+func EpgSettingsFromAttributes(attributes map[string]string) EpgSettings {
+	return EpgSettings{
+		IntraEpgIsolation: attributes["pcEnfPref"] == "enforced",
+		PreferredGroup:    attributes["prefGrMemb"] == "include",
+		FloodOnEncap:      attributes["floodOnEncap"] == "enabled",
+	}
+}
+
+// Set the settings of the EPG MO and return it
+func (mo *ManagedObject) WithEpgSettings(settings EpgSettings) *ManagedObject {
+	for key, value := range settings.Attributes() {
+		mo.Attributes[key] = value
+	}
+	return mo
+}
+
+func TagAnnotationMo(key, value string) *ManagedObject {
+	return NewManagedObject(models.TagAnnotationClassName, map[string]string{"key": key, "value": value})
+}
+
+func ContractConsumerMo(conName string) *ManagedObject {
+	return NewManagedObject(models.FvrsconsClassName, map[string]string{"tnVzBrCPName": conName})
+}
+
+func ContractProviderMo(conName string) *ManagedObject {
+	return NewManagedObject(models.FvrsprovClassName, map[string]string{"tnVzBrCPName": conName})
+}
+
+func ContractMasterMo(tenantName, appMasterName, epgMasterName string) *ManagedObject {
+	return NewManagedObject("fvRsSecInherited", map[string]string{"tDn": fmt.Sprintf("uni/tn-%s/ap-%s/epg-%s", tenantName, appMasterName, epgMasterName)})
+}
+
+// Contract with a single subject (same name) associated to the filters
+func ContractMo(name string, filters []string) *ManagedObject {
+	vzSubj := NewManagedObject(models.VzsubjClassName, map[string]string{"name": name, "revFltPorts": "yes"})
+	for _, flt := range filters {
+		vzSubj.AddChild(SubjectFilterMo(flt))
+	}
+	return NewManagedObject(models.VzbrcpClassName, map[string]string{"name": name, "annotation": "orchestrator:kubernetes"}).AddChild(vzSubj)
+}
+
+func ContractRefMo(name string) *ManagedObject {
+	return NewManagedObject(models.VzbrcpClassName, map[string]string{"name": name})
+}
+
+func SubjectFilterMo(filterName string) *ManagedObject {
+	return NewManagedObject(models.VzrssubjfiltattClassName, map[string]string{"tnVzFilterName": filterName})
+}
+
+// Filter with a single entry (same name)
+func FilterMo(name, eth, ip string, port int) *ManagedObject {
+	vzEntry := NewManagedObject(models.VzentryClassName, map[string]string{"name": name, "etherT": eth})
+	if ip != "" {
+		vzEntry.Attributes["prot"] = ip
+	}
+	if port != 0 {
+		vzEntry.Attributes["dFromPort"] = strconv.Itoa(port)
+		vzEntry.Attributes["dToPort"] = strconv.Itoa(port)
+	}
+	return NewManagedObject(models.VzfilterClassName, map[string]string{"name": name, "annotation": "orchestrator:kubernetes"}).AddChild(vzEntry)
+}
+
+func FilterRefMo(name string) *ManagedObject {
+	return NewManagedObject(models.VzfilterClassName, map[string]string{"name": name})
+}
@@ -0,0 +1,183 @@
+package aci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// Logins (startup & re-authentication) and token refreshes against the APIC
+	apicLoginEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apic_login_events_total",
+			Help: "Number of APIC session events (login, refresh, relogin, rotation) by result",
+		},
+		[]string{"event", "result"},
+	)
+	// Expiry of the current APIC session token
+	apicTokenExpiry = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "apic_session_token_expiry_timestamp_seconds",
+			Help: "Expiry time of the current APIC session token in unix seconds",
+		},
+	)
+	// APIC of the cluster receiving the requests
+	apicActiveController = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apic_active_controller",
+			Help: "Whether the APIC is the one receiving the requests of the operator (1) or not (0)",
+		},
+		[]string{"host"},
+	)
+	// Result of the last health check of each APIC of the cluster
+	apicControllerUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apic_controller_up",
+			Help: "Whether the APIC answered the last health check (1) or not (0)",
+		},
+		[]string{"host"},
+	)
+	// Calls of the ApicInterface methods
+	apicRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apic_requests_total",
+			Help: "Number of calls of each APIC client method",
+		},
+		[]string{"method"},
+	)
+	apicRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "apic_request_duration_seconds",
+			Help:    "Duration of the calls of each APIC client method in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+	apicRequestErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apic_request_errors_total",
+			Help: "Number of failed calls of each APIC client method by HTTP status code (unreachable if no APIC answered, unknown if the status is not known)",
+		},
+		[]string{"method", "code"},
+	)
+	// HTTP responses of the APIC, including the login and token refreshes
+	apicHTTPResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apic_http_responses_total",
+			Help: "Number of HTTP responses received from the APIC by request method and status code",
+		},
+		[]string{"method", "code"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(apicLoginEvents, apicTokenExpiry, apicActiveController, apicControllerUp,
+		apicRequests, apicRequestDuration, apicRequestErrors, apicHTTPResponses)
+}
+
+func recordLoginEvent(event string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	apicLoginEvents.WithLabelValues(event, result).Inc()
+}
+
+// Error of an APIC request whose HTTP status is known
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Err, e.Code)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Status code label of a failed request
+func errorCode(err error) string {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.Code)
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return "unreachable"
+	}
+	return "unknown"
+}
+
+// Hook recording the number, duration and errors of the calls of each method
+type metricsHook struct{}
+
+func MetricsHook() Hook {
+	return metricsHook{}
+}
+
+func (metricsHook) Before(_ context.Context, call *Call) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		apicRequests.WithLabelValues(call.Method).Inc()
+		apicRequestDuration.WithLabelValues(call.Method).Observe(time.Since(start).Seconds())
+		if err != nil {
+			apicRequestErrors.WithLabelValues(call.Method, errorCode(err)).Inc()
+		}
+	}
+}
+
+// HTTP transport counting the responses of the APIC by status code
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		apicHTTPResponses.WithLabelValues(req.Method, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
+
+// HTTP transport recording the status of the last request of a call
+type statusRecorder struct {
+	base http.RoundTripper
+	code int
+	lock sync.Mutex
+}
+
+func (r *statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.base.RoundTrip(req)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.code = 0
+	if err == nil {
+		r.code = resp.StatusCode
+	}
+	return resp, err
+}
+
+// Wrap the error of the call in a StatusError if its last request was answered with an error status
+func (r *statusRecorder) wrap(err error) error {
+	var statusErr *StatusError
+	if err == nil || errors.As(err, &statusErr) {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.code < http.StatusBadRequest {
+		return err
+	}
+	return &StatusError{Code: r.code, Err: err}
+}
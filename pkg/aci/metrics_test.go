@@ -0,0 +1,42 @@
+package aci
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"121","text":"Invalid attribute"}}}]}`)
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+	hooked := NewHookedClient(ac)
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"Save", func() error { return hooked.CreateApplicationProfile("Seg_Pol_k8s", "", "k8s") }},
+		{"Get", func() error { _, err := hooked.EpgExists("ns-a", "Seg_Pol_k8s", "k8s"); return err }},
+		{"GetViaURL", func() error { _, err := hooked.GetTaggedObjects("k8s"); return err }},
+		{"PostTenantConfig", func() error { return hooked.PostTenantConfig(TenantMo("k8s")) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := errorCode(test.call()); code != "400" {
+				t.Errorf("got error code %s, want 400", code)
+			}
+		})
+	}
+
+	apic.server.Close()
+	if code := errorCode(hooked.CreateApplicationProfile("Seg_Pol_k8s", "", "k8s")); code != "unreachable" {
+		t.Errorf("got error code %s, want unreachable", code)
+	}
+	if code := errorCode(errors.New("invalid response")); code != "unknown" {
+		t.Errorf("got error code %s, want unknown", code)
+	}
+}
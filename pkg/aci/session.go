@@ -0,0 +1,219 @@
+package aci
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ciscoecosystem/aci-go-client/models"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Refresh the token this long before it expires
+	tokenRefreshMargin = 60 * time.Second
+	// Wait before retrying a failed refresh/login
+	tokenRetryInterval = 10 * time.Second
+	// Expiry given to the token of the clients built for a single call. The APIC, not the client, decides when the token expires
+	sessionClientLifetime = time.Hour
+)
+
+// APIC errors returned with a 403 when the session token expired or is not valid, as opposed to the user lacking the privileges
+var invalidTokenRegex = regexp.MustCompile(`(?i)token was invalid|token timeout|valid webtoken`)
+
+// Session token of password based logins and its expiry
+type session struct {
+	token  string
+	expiry time.Time
+}
+
+// Login to the APIC with the current credentials and replace the session. Password based clients get a new session token,
+// certificate based clients sign every request so the login only checks the APIC accepts the signature
+func (ac *ApicClient) login(event string) error {
+	ac.clientLock.RLock()
+	credentials := ac.credentials
+	ac.clientLock.RUnlock()
+	s, err := ac.loginWith(credentials, event)
+	if err == nil {
+		ac.clientLock.Lock()
+		// The credentials may have been rotated during the login
+		if ac.credentials == credentials {
+			ac.session = s
+		}
+		ac.clientLock.Unlock()
+	}
+	ac.sessionErrLock.Lock()
+	ac.sessionErr = err
+	ac.sessionErrLock.Unlock()
+	return err
+}
+
+// Error of the last login. Nil if the session is valid
+func (ac *ApicClient) SessionError() error {
+	ac.sessionErrLock.RLock()
+	defer ac.sessionErrLock.RUnlock()
+	return ac.sessionErr
+}
+
+// Login with the credentials without using or modifying the current session
+func (ac *ApicClient) loginWith(credentials Credentials, event string) (session, error) {
+	var s session
+	c := ac.newClient(credentials, "")
+	var err error
+	if credentials.Password != "" {
+		err = c.Authenticate()
+		if err == nil {
+			s = session{token: c.AuthToken.Token, expiry: c.AuthToken.Expiry}
+			apicTokenExpiry.Set(float64(s.expiry.Unix()))
+		}
+	} else {
+		_, err = c.ListSystem()
+	}
+	recordLoginEvent(event, err)
+	return s, err
+}
+
+func (ac *ApicClient) currentSession() session {
+	ac.clientLock.RLock()
+	defer ac.clientLock.RUnlock()
+	return ac.session
+}
+
+// Login again unless another request already replaced the token rejected by the APIC
+func (ac *ApicClient) relogin(staleToken string) (string, error) {
+	ac.sessionLock.Lock()
+	defer ac.sessionLock.Unlock()
+	if token := ac.currentSession().token; token != "" && token != staleToken {
+		return token, nil
+	}
+	if err := ac.login("relogin"); err != nil {
+		return "", err
+	}
+	return ac.currentSession().token, nil
+}
+
+// Extend the lifetime of the session token with aaaRefresh
+func (ac *ApicClient) refresh() error {
+	ac.sessionLock.Lock()
+	defer ac.sessionLock.Unlock()
+	if ac.currentSession().token == "" {
+		return fmt.Errorf("no APIC session to refresh")
+	}
+	cont, err := ac.apic().GetViaURL("/api/aaaRefresh.json")
+	if err != nil {
+		recordLoginEvent("refresh", err)
+		return err
+	}
+	loginCont := cont.S("imdata").Index(0).S("aaaLogin", "attributes")
+	creationTime, errC := strconv.ParseInt(models.G(loginCont, "creationTime"), 10, 64)
+	refreshTimeout, errR := strconv.ParseInt(models.G(loginCont, "refreshTimeoutSeconds"), 10, 64)
+	token := models.G(loginCont, "token")
+	if errC != nil || errR != nil || token == "" {
+		err = fmt.Errorf("invalid aaaRefresh response")
+		recordLoginEvent("refresh", err)
+		return err
+	}
+	// The clients of the calls in flight keep the previous token, which the APIC still accepts
+	s := session{token: token, expiry: time.Unix(creationTime+refreshTimeout, 0)}
+	ac.clientLock.Lock()
+	ac.session = s
+	ac.clientLock.Unlock()
+	apicTokenExpiry.Set(float64(s.expiry.Unix()))
+	recordLoginEvent("refresh", nil)
+	return nil
+}
+
+// Start keeps the APIC session alive, refreshing the token before it expires, health checks the APIC cluster and reloads the CA bundle and credentials.
+// It implements the manager.Runnable interface
+func (ac *ApicClient) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("apic-session")
+	go ac.healthCheckLoop(ctx)
+	go ac.caBundleReloadLoop(ctx)
+	go ac.credentialsReloadLoop(ctx)
+	for {
+		wait := tokenRetryInterval
+		if s := ac.currentSession(); s.token != "" {
+			if untilExpiry := time.Until(s.expiry) - tokenRefreshMargin; untilExpiry > wait {
+				wait = untilExpiry
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		// Certificate based authentication does not use session tokens
+		if !ac.usesPassword() || ac.hostCount() == 0 {
+			continue
+		}
+		if err := ac.refresh(); err != nil {
+			logger.Info(fmt.Sprintf("Unable to refresh the APIC token, logging in again: %s", err))
+			if _, err := ac.relogin(ac.currentSession().token); err != nil {
+				logger.Error(err, "Unable to login to the APIC")
+			}
+		}
+	}
+}
+
+// The session is also used to report readiness, so it runs on every replica and not only on the leader
+func (ac *ApicClient) NeedLeaderElection() bool {
+	return false
+}
+
+// HTTP transport that logs in again and retries the request once when the APIC rejects the session token: 401, or 403 with
+// a token error. Other 403s (missing privileges) are returned as they are
+type sessionTransport struct {
+	base http.RoundTripper
+	ac   *ApicClient
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Login/refresh requests and certificate based (signed) requests are never retried
+	staleCookie, err := req.Cookie("APIC-Cookie")
+	if err != nil || strings.Contains(req.URL.Path, "/api/aaaLogin") || strings.Contains(req.URL.Path, "/api/aaaRefresh") {
+		return t.base.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || !invalidToken(resp) {
+		return resp, err
+	}
+
+	token, err := t.ac.relogin(staleCookie.Value)
+	if err != nil {
+		// Return the original response. The caller handles the authentication error
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	retry.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	retry.Header.Del("Cookie")
+	retry.AddCookie(&http.Cookie{Name: "APIC-Cookie", Value: token})
+	return t.base.RoundTrip(retry)
+}
+
+// Whether the APIC rejected the session token. The body of 403 responses is read and restored for the caller
+func invalidToken(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		return invalidTokenRegex.Match(body)
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package aci
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSessionTransport(t *testing.T) {
+	tests := []struct {
+		name string
+		// Answer of the APIC to the requests with a valid token
+		status int
+		body   string
+		// Invalidate the token before the request
+		expire     bool
+		wantErr    bool
+		wantCalls  int32
+		wantLogins int
+	}{
+		{name: "valid token", status: http.StatusOK, body: apicEmptyResponse, wantCalls: 1, wantLogins: 1},
+		// The APIC rejects the expired token before the handler. The request is retried once with the new token
+		{name: "expired token", status: http.StatusOK, body: apicEmptyResponse, expire: true, wantCalls: 1, wantLogins: 2},
+		{name: "token rejected again", status: http.StatusUnauthorized, body: `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"401","text":"Unauthorized"}}}]}`,
+			wantErr: true, wantCalls: 2, wantLogins: 2},
+		{name: "missing privileges", status: http.StatusForbidden, body: `{"totalCount":"1","imdata":[{"error":{"attributes":{"code":"403","text":"access denied"}}}]}`,
+			wantErr: true, wantCalls: 1, wantLogins: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int32
+			apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			})
+			ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+			if test.expire {
+				apic.expireToken()
+			}
+
+			_, err := ac.GetObject("uni/tn-k8s")
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			if calls := atomic.LoadInt32(&calls); calls != test.wantCalls {
+				t.Errorf("got %d requests, want %d", calls, test.wantCalls)
+			}
+			if logins := apic.loginCount(); logins != test.wantLogins {
+				t.Errorf("got %d logins, want %d", logins, test.wantLogins)
+			}
+		})
+	}
+}
+
+// Concurrent requests rejected with the same expired token only login once
+func TestSessionReloginOnce(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	ac := newTestApicClient(t, StaticCredentials(Credentials{Username: "admin", Password: "secret"}), apic)
+	apic.expireToken()
+
+	errs := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func() {
+			_, err := ac.GetObject("uni/tn-k8s")
+			errs <- err
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+	if logins := apic.loginCount(); logins != 2 {
+		t.Errorf("got %d logins, want 2", logins)
+	}
+}
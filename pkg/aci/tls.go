@@ -0,0 +1,177 @@
+package aci
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Interval between reloads of the CA bundle
+	caBundleReloadInterval = 60 * time.Second
+)
+
+// Source of the PEM encoded CA bundle used to verify the APIC certificate
+type CABundleSource func(ctx context.Context) ([]byte, error)
+
+// TLS settings of the connections to the APIC
+type TLSConfig struct {
+	// Skip the verification of the APIC certificate. Only meant to be explicitly enabled in lab environments
+	Insecure bool
+	// Name used to verify the APIC certificate (and sent as SNI) instead of the APIC host
+	ServerName string
+	// CA bundle used to verify the APIC certificate. The system CAs are used if not set
+	CABundle CABundleSource
+}
+
+func CABundleFromFile(path string) CABundleSource {
+	return func(_ context.Context) ([]byte, error) {
+		return ioutil.ReadFile(path)
+	}
+}
+
+func CABundleFromSecret(c client.Reader, namespace, name, key string) CABundleSource {
+	return func(ctx context.Context) ([]byte, error) {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+			return nil, err
+		}
+		bundle, ok := secret.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found in Secret %s/%s", key, namespace, name)
+		}
+		return bundle, nil
+	}
+}
+
+func CABundleFromConfigMap(c client.Reader, namespace, name, key string) CABundleSource {
+	return func(ctx context.Context) ([]byte, error) {
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, configMap); err != nil {
+			return nil, err
+		}
+		bundle, ok := configMap.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found in ConfigMap %s/%s", key, namespace, name)
+		}
+		return []byte(bundle), nil
+	}
+}
+
+// Build one HTTP transport per APIC so that each APIC certificate is verified against its own host (or the ServerName override)
+func (ac *ApicClient) buildTransports(hosts []string, caBundle []byte) (map[string]*http.Transport, error) {
+	var rootCAs *x509.CertPool
+	if len(caBundle) > 0 {
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no valid certificate found in the APIC CA bundle")
+		}
+	}
+	transports := map[string]*http.Transport{}
+	for _, host := range hosts {
+		serverName := ac.tlsConfig.ServerName
+		if serverName == "" {
+			serverName = host
+		}
+		transports[host] = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: ac.tlsConfig.Insecure,
+				ServerName:         serverName,
+				RootCAs:            rootCAs,
+				MinVersion:         tls.VersionTLS12,
+			},
+		}
+	}
+	return transports, nil
+}
+
+// Load the CA bundle and replace the transports if the bundle changed
+func (ac *ApicClient) loadCABundle(ctx context.Context) (bool, error) {
+	caBundle := []byte{}
+	if ac.tlsConfig.CABundle != nil && !ac.tlsConfig.Insecure {
+		var err error
+		if caBundle, err = ac.tlsConfig.CABundle(ctx); err != nil {
+			return false, fmt.Errorf("unable to read the APIC CA bundle: %w", err)
+		}
+	}
+	ac.tlsLock.Lock()
+	defer ac.tlsLock.Unlock()
+	if ac.transports != nil && bytes.Equal(caBundle, ac.caBundle) {
+		return false, nil
+	}
+	ac.hostsLock.RLock()
+	hosts := ac.hosts
+	ac.hostsLock.RUnlock()
+	transports, err := ac.buildTransports(hosts, caBundle)
+	if err != nil {
+		return false, err
+	}
+	for _, transport := range ac.transports {
+		transport.CloseIdleConnections()
+	}
+	ac.transports, ac.caBundle = transports, caBundle
+	return true, nil
+}
+
+func (ac *ApicClient) caBundleReloadLoop(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("apic-tls")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(caBundleReloadInterval):
+		}
+		reloaded, err := ac.loadCABundle(ctx)
+		if err != nil {
+			// Keep using the last valid bundle
+			logger.Error(err, "Unable to reload the APIC CA bundle")
+		} else if reloaded {
+			logger.Info("APIC CA bundle reloaded")
+		}
+	}
+}
+
+// Replace the transports with the ones of the new APICs
+func (ac *ApicClient) setHostsTransports(hosts []string) error {
+	ac.tlsLock.Lock()
+	defer ac.tlsLock.Unlock()
+	transports, err := ac.buildTransports(hosts, ac.caBundle)
+	if err != nil {
+		return err
+	}
+	for _, transport := range ac.transports {
+		transport.CloseIdleConnections()
+	}
+	ac.transports = transports
+	return nil
+}
+
+// HTTP transport of the APIC host
+func (ac *ApicClient) hostTransport(host string) http.RoundTripper {
+	ac.tlsLock.RLock()
+	defer ac.tlsLock.RUnlock()
+	if transport, ok := ac.transports[host]; ok {
+		return transport
+	}
+	// The APIC was removed from the cluster while the request was being sent
+	return errorTransport{fmt.Errorf("APIC %s is not configured", host)}
+}
+
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(_ *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
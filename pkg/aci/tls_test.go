@@ -0,0 +1,107 @@
+package aci
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// PEM encoded self-signed certificate of a CA which did not sign the certificate of the fake APICs
+func otherCABundle(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestUntrustedCertificate(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	credentials := StaticCredentials(Credentials{Username: "admin", Password: "secret"})
+	tests := []struct {
+		name      string
+		tlsConfig TLSConfig
+		wantErr   bool
+	}{
+		{"trusted CA", TLSConfig{ServerName: "example.com", CABundle: staticCABundle(apic.caBundle())}, false},
+		{"system CAs", TLSConfig{ServerName: "example.com"}, true},
+		{"other CA", TLSConfig{ServerName: "example.com", CABundle: staticCABundle(otherCABundle(t))}, true},
+		{"other server name", TLSConfig{ServerName: "apic.example.org", CABundle: staticCABundle(apic.caBundle())}, true},
+		{"insecure", TLSConfig{Insecure: true}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewApicClient([]string{apic.host()}, credentials, test.tlsConfig)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCABundleReload(t *testing.T) {
+	apic := newFakeApic(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, apicEmptyResponse)
+	})
+	var lock sync.Mutex
+	bundle := otherCABundle(t)
+	source := func(_ context.Context) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return bundle, nil
+	}
+	ac, err := NewApicClient([]string{apic.host()}, StaticCredentials(Credentials{Username: "admin", Password: "secret"}),
+		TLSConfig{ServerName: "example.com", CABundle: source})
+	if err == nil {
+		t.Fatalf("expected the login to fail with the CA bundle of another CA")
+	}
+
+	if reloaded, err := ac.loadCABundle(context.Background()); err != nil || reloaded {
+		t.Errorf("got reloaded %v (error %v) with the same CA bundle, want false", reloaded, err)
+	}
+	lock.Lock()
+	bundle = apic.caBundle()
+	lock.Unlock()
+	if reloaded, err := ac.loadCABundle(context.Background()); err != nil || !reloaded {
+		t.Fatalf("got reloaded %v (error %v) with a new CA bundle, want true", reloaded, err)
+	}
+	if err := ac.login("login"); err != nil {
+		t.Errorf("unexpected error with the reloaded CA bundle: %s", err)
+	}
+
+	// Invalid bundles are rejected and the last valid one is kept
+	lock.Lock()
+	bundle = []byte("not a certificate")
+	lock.Unlock()
+	if _, err := ac.loadCABundle(context.Background()); err == nil {
+		t.Errorf("expected the invalid CA bundle to be rejected")
+	}
+	if _, err := ac.GetObject("uni/tn-k8s"); err != nil {
+		t.Errorf("unexpected error with the last valid CA bundle: %s", err)
+	}
+}
@@ -0,0 +1,37 @@
+package aci
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/jgomezve/aci-k8s-operator/pkg/aci"
+
+// Attribute of the spans with the DN of the APIC object
+const AttributeDn = attribute.Key("aci.dn")
+
+// Hook creating a span for every call, with the DN of the APIC object as attribute. The spans are children of the span of the context
+// the client is bound to
+type tracingHook struct {
+	tracer trace.Tracer
+}
+
+// Trace the calls to the APIC client with the global TracerProvider
+func TracingHook() Hook {
+	return &tracingHook{tracer: otel.Tracer(tracerName)}
+}
+
+func (h *tracingHook) Before(ctx context.Context, call *Call) func(err error) {
+	_, span := h.tracer.Start(ctx, "aci."+call.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(AttributeDn.String(call.Dn)))
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,60 @@
+package aci
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingHook(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	apic := NewHookedClient(newTestMock(), TracingHook())
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "Reconcile")
+	bound := apic.(ContextClient).WithContext(ctx)
+
+	if _, err := bound.EpgExists("ns-a", "Seg_Pol_k8s", "k8s"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := bound.PostTenantConfig(TenantMo("k8s").AddChild(FilterMo("flt", "ip", "tcp", 443))); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	parent.End()
+
+	tests := []struct {
+		name string
+		dn   string
+	}{
+		{name: "aci.EpgExists", dn: "uni/tn-k8s/ap-Seg_Pol_k8s/epg-ns-a"},
+		{name: "aci.PostTenantConfig", dn: "uni/tn-k8s"},
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != len(tests)+1 {
+		t.Fatalf("got %d spans, want %d", len(spans), len(tests)+1)
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name != tt.name {
+			t.Errorf("span %d: got name %s, want %s", i, span.Name, tt.name)
+		}
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s is not a child of the reconcile span", span.Name)
+		}
+		dn := ""
+		for _, attr := range span.Attributes {
+			if attr.Key == AttributeDn {
+				dn = attr.Value.AsString()
+			}
+		}
+		if dn != tt.dn {
+			t.Errorf("span %s: got DN %q, want %q", span.Name, dn, tt.dn)
+		}
+	}
+}
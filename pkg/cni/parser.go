@@ -0,0 +1,164 @@
+package cni
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jgomezve/aci-k8s-operator/pkg/utils"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// Sections (keys) of the ConfigMap aci-containers-config
+	ControllerConfigKey = "controller-config"
+	HostAgentConfigKey  = "host-agent-config"
+)
+
+var (
+	ErrMissingKey   = errors.New("missing key")
+	ErrInvalidValue = errors.New("invalid value")
+
+	// uni/tn-<tenant>/BD-<bd>. Some aci-containers versions write the DN without the uni/ prefix
+	bdDnRegex = regexp.MustCompile(`^(?:uni/)?tn-([^/]+)/BD-([^/]+)$`)
+)
+
+// ACI parameters of the cluster discovered from the ACI CNI
+type Config struct {
+	ApicHosts                 []string
+	ApicUsername              string
+	PrivateKeyPath            string
+	PolicyTenant              string
+	PodBridgeDomain           string
+	VmmDomain                 string
+	DefaultApplicationProfile string
+	DefaultEndpointGroup      string
+}
+
+// Error of a key of the ACI CNI configuration. It wraps ErrMissingKey or ErrInvalidValue
+type KeyError struct {
+	Section string
+	Key     string
+	Value   string
+	Err     error
+}
+
+func (e *KeyError) Error() string {
+	name := e.Key
+	if e.Section != e.Key {
+		name = fmt.Sprintf("%s.%s", e.Section, e.Key)
+	}
+	if e.Value == "" {
+		return fmt.Sprintf("%s: %s", name, e.Err)
+	}
+	return fmt.Sprintf("%s: %s %q", name, e.Err, e.Value)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// All the errors found in the ACI CNI configuration
+type ParseErrors []*KeyError
+
+func (e ParseErrors) Error() string {
+	msgs := []string{}
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Keys reporting an error
+func (e ParseErrors) Keys() []string {
+	keys := []string{}
+	for _, err := range e {
+		keys = append(keys, err.Key)
+	}
+	return keys
+}
+
+// Parse the data of the ConfigMap aci-containers-config. All the keys are validated, and every invalid or missing key is returned in ParseErrors
+func Parse(data map[string]string) (Config, error) {
+	errs := ParseErrors{}
+	controllerConfig := section(data, ControllerConfigKey, &errs)
+	hostAgentConfig := section(data, HostAgentConfigKey, &errs)
+	if len(errs) > 0 {
+		return Config{}, errs
+	}
+
+	config := Config{
+		ApicUsername:   controllerConfig.Get("apic-username").String(),
+		PrivateKeyPath: controllerConfig.Get("apic-private-key-path").String(),
+		PolicyTenant:   required(controllerConfig, ControllerConfigKey, "aci-policy-tenant", &errs),
+		VmmDomain:      required(controllerConfig, ControllerConfigKey, "aci-vmm-domain", &errs),
+	}
+
+	// Older aci-containers versions define a single APIC as a string
+	apicHosts := controllerConfig.Get("apic-hosts")
+	for _, host := range apicHosts.Array() {
+		config.ApicHosts = append(config.ApicHosts, strings.TrimSpace(host.String()))
+	}
+	if !apicHosts.Exists() {
+		errs = append(errs, &KeyError{Section: ControllerConfigKey, Key: "apic-hosts", Err: ErrMissingKey})
+	} else if len(config.ApicHosts) == 0 || utils.Contains(config.ApicHosts, "") {
+		errs = append(errs, &KeyError{Section: ControllerConfigKey, Key: "apic-hosts", Value: apicHosts.Raw, Err: ErrInvalidValue})
+	}
+
+	if bdDn := required(controllerConfig, ControllerConfigKey, "aci-podbd-dn", &errs); bdDn != "" {
+		if match := bdDnRegex.FindStringSubmatch(bdDn); match != nil {
+			config.PodBridgeDomain = match[2]
+		} else {
+			errs = append(errs, &KeyError{Section: ControllerConfigKey, Key: "aci-podbd-dn", Value: bdDn, Err: ErrInvalidValue})
+		}
+	}
+
+	// The default EPG is named <app-profile>|<epg>. Some aci-containers versions only set the EPG and define the Application Profile in app-profile
+	config.DefaultApplicationProfile = hostAgentConfig.Get("app-profile").String()
+	if epg := required(hostAgentConfig, HostAgentConfigKey, "default-endpoint-group.name", &errs); epg != "" {
+		parts := strings.Split(epg, "|")
+		switch {
+		case len(parts) == 1:
+			config.DefaultEndpointGroup = parts[0]
+		case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+			config.DefaultEndpointGroup = parts[1]
+			if config.DefaultApplicationProfile == "" {
+				config.DefaultApplicationProfile = parts[0]
+			}
+		default:
+			errs = append(errs, &KeyError{Section: HostAgentConfigKey, Key: "default-endpoint-group.name", Value: epg, Err: ErrInvalidValue})
+		}
+	}
+	if config.DefaultApplicationProfile == "" && config.DefaultEndpointGroup != "" {
+		errs = append(errs, &KeyError{Section: HostAgentConfigKey, Key: "app-profile", Err: ErrMissingKey})
+	}
+
+	if len(errs) > 0 {
+		return Config{}, errs
+	}
+	return config, nil
+}
+
+// JSON document of a section of the ConfigMap
+func section(data map[string]string, key string, errs *ParseErrors) gjson.Result {
+	content, ok := data[key]
+	if !ok {
+		*errs = append(*errs, &KeyError{Section: key, Key: key, Err: ErrMissingKey})
+		return gjson.Result{}
+	}
+	if !gjson.Valid(content) {
+		*errs = append(*errs, &KeyError{Section: key, Key: key, Err: fmt.Errorf("%w (not a JSON document)", ErrInvalidValue)})
+		return gjson.Result{}
+	}
+	return gjson.Parse(content)
+}
+
+// Value of a key that must be set
+func required(doc gjson.Result, section, key string, errs *ParseErrors) string {
+	value := strings.TrimSpace(doc.Get(key).String())
+	if value == "" {
+		*errs = append(*errs, &KeyError{Section: section, Key: key, Err: ErrMissingKey})
+	}
+	return value
+}
@@ -0,0 +1,204 @@
+package cni
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const (
+	controllerConfig = `{
+		"apic-hosts": ["10.0.0.1", "10.0.0.2"],
+		"apic-username": "k8s-user",
+		"apic-private-key-path": "/usr/local/etc/aci-cert/user.key",
+		"aci-policy-tenant": "k8s-tenant",
+		"aci-podbd-dn": "uni/tn-k8s-tenant/BD-aci-containers-k8s-pod-bd",
+		"aci-vmm-domain": "k8s-vmm"
+	}`
+	hostAgentConfig = `{
+		"app-profile": "aci-containers-k8s",
+		"default-endpoint-group": {"policy-space": "k8s-tenant", "name": "aci-containers-k8s|aci-containers-default"}
+	}`
+)
+
+var validConfig = Config{
+	ApicHosts:                 []string{"10.0.0.1", "10.0.0.2"},
+	ApicUsername:              "k8s-user",
+	PrivateKeyPath:            "/usr/local/etc/aci-cert/user.key",
+	PolicyTenant:              "k8s-tenant",
+	PodBridgeDomain:           "aci-containers-k8s-pod-bd",
+	VmmDomain:                 "k8s-vmm",
+	DefaultApplicationProfile: "aci-containers-k8s",
+	DefaultEndpointGroup:      "aci-containers-default",
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   map[string]string
+		config Config
+	}{
+		{
+			name:   "valid configuration",
+			data:   map[string]string{ControllerConfigKey: controllerConfig, HostAgentConfigKey: hostAgentConfig},
+			config: validConfig,
+		},
+		{
+			name: "single APIC defined as a string",
+			data: map[string]string{
+				ControllerConfigKey: `{"apic-hosts": "10.0.0.1", "aci-policy-tenant": "k8s-tenant", "aci-podbd-dn": "uni/tn-k8s-tenant/BD-pod-bd", "aci-vmm-domain": "k8s-vmm"}`,
+				HostAgentConfigKey:  hostAgentConfig,
+			},
+			config: Config{
+				ApicHosts:                 []string{"10.0.0.1"},
+				PolicyTenant:              "k8s-tenant",
+				PodBridgeDomain:           "pod-bd",
+				VmmDomain:                 "k8s-vmm",
+				DefaultApplicationProfile: "aci-containers-k8s",
+				DefaultEndpointGroup:      "aci-containers-default",
+			},
+		},
+		{
+			name: "Bridge Domain DN without uni prefix",
+			data: map[string]string{
+				ControllerConfigKey: `{"apic-hosts": ["10.0.0.1"], "aci-policy-tenant": "k8s-tenant", "aci-podbd-dn": "tn-common/BD-pod-bd", "aci-vmm-domain": "k8s-vmm"}`,
+				HostAgentConfigKey:  hostAgentConfig,
+			},
+			config: Config{
+				ApicHosts:                 []string{"10.0.0.1"},
+				PolicyTenant:              "k8s-tenant",
+				PodBridgeDomain:           "pod-bd",
+				VmmDomain:                 "k8s-vmm",
+				DefaultApplicationProfile: "aci-containers-k8s",
+				DefaultEndpointGroup:      "aci-containers-default",
+			},
+		},
+		{
+			name: "default EPG without Application Profile",
+			data: map[string]string{
+				ControllerConfigKey: controllerConfig,
+				HostAgentConfigKey:  `{"app-profile": "kubernetes", "default-endpoint-group": {"name": "kube-default"}}`,
+			},
+			config: Config{
+				ApicHosts:                 validConfig.ApicHosts,
+				ApicUsername:              validConfig.ApicUsername,
+				PrivateKeyPath:            validConfig.PrivateKeyPath,
+				PolicyTenant:              validConfig.PolicyTenant,
+				PodBridgeDomain:           validConfig.PodBridgeDomain,
+				VmmDomain:                 validConfig.VmmDomain,
+				DefaultApplicationProfile: "kubernetes",
+				DefaultEndpointGroup:      "kube-default",
+			},
+		},
+		{
+			name: "Application Profile only defined in the default EPG",
+			data: map[string]string{
+				ControllerConfigKey: controllerConfig,
+				HostAgentConfigKey:  `{"default-endpoint-group": {"name": "kubernetes|kube-default"}}`,
+			},
+			config: Config{
+				ApicHosts:                 validConfig.ApicHosts,
+				ApicUsername:              validConfig.ApicUsername,
+				PrivateKeyPath:            validConfig.PrivateKeyPath,
+				PolicyTenant:              validConfig.PolicyTenant,
+				PodBridgeDomain:           validConfig.PodBridgeDomain,
+				VmmDomain:                 validConfig.VmmDomain,
+				DefaultApplicationProfile: "kubernetes",
+				DefaultEndpointGroup:      "kube-default",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse(tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(config, tt.config) {
+				t.Errorf("got %+v, want %+v", config, tt.config)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]string
+		// Keys reported in the errors and the error wrapped by each of them
+		keys []string
+		errs []error
+	}{
+		{
+			name: "missing sections",
+			data: map[string]string{},
+			keys: []string{ControllerConfigKey, HostAgentConfigKey},
+			errs: []error{ErrMissingKey, ErrMissingKey},
+		},
+		{
+			name: "section not in JSON format",
+			data: map[string]string{ControllerConfigKey: "apic-hosts: 10.0.0.1", HostAgentConfigKey: hostAgentConfig},
+			keys: []string{ControllerConfigKey},
+			errs: []error{ErrInvalidValue},
+		},
+		{
+			name: "missing keys",
+			data: map[string]string{ControllerConfigKey: `{"apic-username": "k8s-user"}`, HostAgentConfigKey: `{}`},
+			keys: []string{"aci-policy-tenant", "aci-vmm-domain", "apic-hosts", "aci-podbd-dn", "default-endpoint-group.name"},
+			errs: []error{ErrMissingKey, ErrMissingKey, ErrMissingKey, ErrMissingKey, ErrMissingKey},
+		},
+		{
+			name: "empty APIC list",
+			data: map[string]string{
+				ControllerConfigKey: `{"apic-hosts": [], "aci-policy-tenant": "k8s-tenant", "aci-podbd-dn": "uni/tn-k8s-tenant/BD-pod-bd", "aci-vmm-domain": "k8s-vmm"}`,
+				HostAgentConfigKey:  hostAgentConfig,
+			},
+			keys: []string{"apic-hosts"},
+			errs: []error{ErrInvalidValue},
+		},
+		{
+			name: "invalid Bridge Domain DN",
+			data: map[string]string{
+				ControllerConfigKey: `{"apic-hosts": ["10.0.0.1"], "aci-policy-tenant": "k8s-tenant", "aci-podbd-dn": "pod-bd", "aci-vmm-domain": "k8s-vmm"}`,
+				HostAgentConfigKey:  hostAgentConfig,
+			},
+			keys: []string{"aci-podbd-dn"},
+			errs: []error{ErrInvalidValue},
+		},
+		{
+			name: "invalid default EPG",
+			data: map[string]string{
+				ControllerConfigKey: controllerConfig,
+				HostAgentConfigKey:  `{"app-profile": "kubernetes", "default-endpoint-group": {"name": "kubernetes|"}}`,
+			},
+			keys: []string{"default-endpoint-group.name"},
+			errs: []error{ErrInvalidValue},
+		},
+		{
+			name: "missing Application Profile",
+			data: map[string]string{
+				ControllerConfigKey: controllerConfig,
+				HostAgentConfigKey:  `{"default-endpoint-group": {"name": "kube-default"}}`,
+			},
+			keys: []string{"app-profile"},
+			errs: []error{ErrMissingKey},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data)
+			var parseErrs ParseErrors
+			if !errors.As(err, &parseErrs) {
+				t.Fatalf("expected ParseErrors, got %v", err)
+			}
+			if !reflect.DeepEqual(parseErrs.Keys(), tt.keys) {
+				t.Errorf("got errors for keys %v, want %v", parseErrs.Keys(), tt.keys)
+			}
+			for i, keyErr := range parseErrs {
+				if i < len(tt.errs) && !errors.Is(keyErr, tt.errs[i]) {
+					t.Errorf("key %s: got %v, want %v", keyErr.Key, keyErr, tt.errs[i])
+				}
+			}
+		})
+	}
+}
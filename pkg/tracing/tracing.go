@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+const (
+	ServiceName = "aci-k8s-operator"
+	// Time to flush the pending spans when the operator stops
+	shutdownTimeout = 5 * time.Second
+)
+
+// Whether the spans must be exported, either because the endpoint is set or the standard OTEL_EXPORTER_OTLP_* variables are defined
+func Enabled(endpoint string) bool {
+	return endpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Export the spans to an OTLP/gRPC collector and set the global TracerProvider. The endpoint overrides the OTEL_EXPORTER_OTLP_* variables.
+// The returned function flushes the pending spans and stops the exporter
+func Setup(ctx context.Context, endpoint string, insecure bool) (func() error, error) {
+	opts := []otlptracegrpc.Option{}
+	if endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+	}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return SetupWithExporter(exporter), nil
+}
+
+// Set the global TracerProvider with the exporter, e.g. an in-memory exporter in the tests
+func SetupWithExporter(exporter sdktrace.SpanExporter) func() error {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return provider.Shutdown(ctx)
+	}
+}